@@ -0,0 +1,9 @@
+// range:class
+class Greeter {
+  // range:method
+  greet(name: string) {
+    return `Hello, ${name}!`;
+  }
+  // range.end:method
+}
+// range.end:class
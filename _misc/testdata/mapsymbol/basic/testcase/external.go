@@ -0,0 +1,14 @@
+package main
+
+// Greeter greets.
+type Greeter struct {
+	Name string
+}
+
+// Greet returns greeting message.
+func (g *Greeter) Greet() string {
+	if g.Name == "" {
+		return "Hello!"
+	}
+	return "Hello, " + g.Name
+}
@@ -0,0 +1,75 @@
+package ptproc
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// anchorRange selects lines between the line matched by from and the line matched by to.
+type anchorRange struct {
+	// from must match exactly one line. nil means the first line.
+	from *regexp.Regexp
+	// to is searched after the from line and the first matched line is used. nil means the last line.
+	to          *regexp.Regexp
+	excludeFrom bool
+	excludeTo   bool
+}
+
+// selectLines returns lines of s selected by ar.
+// anchors are matched against lines without line endings, so "$" matches the end of the line.
+func (ar *anchorRange) selectLines(s string) (string, error) {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	start := 0
+	if ar.from != nil {
+		start = -1
+		for idx, line := range lines {
+			if !ar.from.MatchString(strings.TrimRight(line, "\r\n")) {
+				continue
+			}
+			if start != -1 {
+				return "", fmt.Errorf("from anchor %q matches more than once. lines %d and %d", ar.from, start+1, idx+1)
+			}
+			start = idx
+		}
+		if start == -1 {
+			return "", fmt.Errorf("from anchor %q doesn't match any lines", ar.from)
+		}
+	}
+
+	end := len(lines) - 1
+	if ar.to != nil {
+		end = -1
+		// the from line itself can be the to line. e.g. one line declaration
+		for idx, line := range lines[start:] {
+			if ar.to.MatchString(strings.TrimRight(line, "\r\n")) {
+				end = start + idx
+				break
+			}
+		}
+		if end == -1 {
+			return "", fmt.Errorf("to anchor %q doesn't match any lines after line %d", ar.to, start+1)
+		}
+	}
+
+	if ar.from != nil && ar.excludeFrom {
+		start++
+	}
+	if ar.to != nil && ar.excludeTo {
+		end--
+	}
+
+	var buf strings.Builder
+	for idx := start; idx <= end; idx++ {
+		buf.WriteString(lines[idx])
+		if !strings.HasSuffix(lines[idx], "\n") {
+			buf.WriteString("\n")
+		}
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,92 @@
+package ptproc
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/MakeNowJust/heredoc/v2"
+)
+
+func Test_anchorRange_selectLines(t *testing.T) {
+	t.Parallel()
+
+	src := heredoc.Doc(`
+		package main
+
+		func Parse() {
+			parse()
+		}
+
+		func Format() {
+			format()
+		}
+	`)
+
+	tests := []struct {
+		name    string
+		input   string
+		ar      *anchorRange
+		output  string
+		wantErr bool
+	}{
+		{
+			name:  "from and to",
+			input: src,
+			ar:    &anchorRange{from: regexp.MustCompile(`^func Parse`), to: regexp.MustCompile(`^}`)},
+			output: heredoc.Doc(`
+				func Parse() {
+					parse()
+				}
+			`),
+		},
+		{
+			name:  "end of line anchors",
+			input: src,
+			ar:    &anchorRange{from: regexp.MustCompile(`^func Format\(\) {$`), to: regexp.MustCompile(`^}$`)},
+			output: heredoc.Doc(`
+				func Format() {
+					format()
+				}
+			`),
+		},
+		{
+			name:   "end of line anchors with CRLF",
+			input:  "a\r\nb\r\nc\r\n",
+			ar:     &anchorRange{from: regexp.MustCompile(`^a$`), to: regexp.MustCompile(`^b$`)},
+			output: "a\r\nb\r\n",
+		},
+		{
+			name:   "exclude anchors",
+			input:  src,
+			ar:     &anchorRange{from: regexp.MustCompile(`^func Parse`), to: regexp.MustCompile(`^}$`), excludeFrom: true, excludeTo: true},
+			output: "\tparse()\n",
+		},
+		{
+			name:    "from matches more than once",
+			input:   src,
+			ar:      &anchorRange{from: regexp.MustCompile(`^func`)},
+			wantErr: true,
+		},
+		{
+			name:    "to doesn't match",
+			input:   src,
+			ar:      &anchorRange{from: regexp.MustCompile(`^func Parse`), to: regexp.MustCompile(`^};$`)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			output, err := tt.ar.selectLines(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if output != tt.output {
+				t.Errorf("got = %q, want %q", output, tt.output)
+			}
+		})
+	}
+}
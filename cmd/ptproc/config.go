@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/urfave/cli/v2"
+	"github.com/vvakame/ptproc"
+)
+
+// configFiles returns config files used for the file.
+// the file specified by --config is used if exists, otherwise config files are discovered from the directory of the file.
+func configFiles(cCtx *cli.Context, filePath string) ([]string, error) {
+	ctx := cCtx.Context
+
+	if configFilePath := cCtx.String("config"); configFilePath != "" {
+		if _, err := os.Stat(configFilePath); err != nil {
+			return nil, fmt.Errorf("failed to load config file: %s, : %w", configFilePath, err)
+		}
+		return []string{configFilePath}, nil
+	}
+
+	filePaths, err := ptproc.FindConfigFiles(filePath, cCtx.String("root"))
+	if err != nil {
+		return nil, err
+	}
+	if len(filePaths) != 0 {
+		return filePaths, nil
+	}
+
+	// the file is outside of the working directory tree. keep using the config file in the working directory.
+	for _, name := range ptproc.ConfigFileNames {
+		if _, err := os.Stat(name); err == nil {
+			return []string{name}, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	slog.DebugContext(ctx, "ptproc.yaml is not exists. ignored", slog.String("filePath", filePath))
+
+	return nil, nil
+}
+
+// loadProcessorConfig loads config files and applies flags. returns nil if there is nothing to configure.
+func loadProcessorConfig(cCtx *cli.Context, configFilePaths []string) (*ptproc.ProcessorConfig, error) {
+	ctx := cCtx.Context
+
+	var cfg *ptproc.ProcessorConfig
+	if len(configFilePaths) != 0 {
+		rawCfg, err := ptproc.LoadConfigs(ctx, configFilePaths)
+		if err != nil {
+			return nil, err
+		}
+		cfg, err = rawCfg.ToProcessorConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rootDir := cCtx.String("root")
+	includePaths := cCtx.StringSlice("include")
+
+	if rootDir != "" {
+		if cfg == nil {
+			cfg = &ptproc.ProcessorConfig{}
+		}
+		sandbox := &ptproc.Sandbox{
+			RootDir: rootDir,
+		}
+		if cfg.Sandbox != nil {
+			sandbox.AllowedDirs = cfg.Sandbox.AllowedDirs
+		}
+		cfg.Sandbox = sandbox
+		cfg.RootDir = rootDir
+	}
+	if len(includePaths) != 0 {
+		if cfg == nil {
+			cfg = &ptproc.ProcessorConfig{}
+		}
+		cfg.IncludePaths = append(slices.Clip(includePaths), cfg.IncludePaths...)
+	}
+
+	return cfg, nil
+}
+
+// newProcessor returns the processor for target files.
+// files which use different config files are processed by different processors.
+func newProcessor(cCtx *cli.Context, filePaths []string) (ptproc.Processor, error) {
+	var keys []string
+	configFilesByKey := make(map[string][]string)
+	keyByFile := make(map[string]string)
+	for _, filePath := range filePaths {
+		cfgFiles, err := configFiles(cCtx, filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		key := strings.Join(cfgFiles, "\n")
+		if _, ok := configFilesByKey[key]; !ok {
+			keys = append(keys, key)
+			configFilesByKey[key] = cfgFiles
+		}
+		// watch and other commands pass absolute paths. key by the absolute path to find the processor for both.
+		absPath, err := filepath.Abs(filePath)
+		if err != nil {
+			return nil, err
+		}
+		keyByFile[absPath] = key
+	}
+
+	if len(keys) == 0 {
+		cfg, err := loadProcessorConfig(cCtx, nil)
+		if err != nil {
+			return nil, err
+		}
+		return ptproc.NewProcessor(cfg)
+	}
+
+	procByKey := make(map[string]ptproc.Processor)
+	for _, key := range keys {
+		cfg, err := loadProcessorConfig(cCtx, configFilesByKey[key])
+		if err != nil {
+			return nil, err
+		}
+		proc, err := ptproc.NewProcessor(cfg)
+		if err != nil {
+			return nil, err
+		}
+		procByKey[key] = proc
+	}
+
+	if len(keys) == 1 {
+		return procByKey[keys[0]], nil
+	}
+
+	procs := make(map[string]ptproc.Processor)
+	for filePath, key := range keyByFile {
+		procs[filePath] = procByKey[key]
+	}
+
+	return &fileProcessor{
+		procs:    procs,
+		fallback: procByKey[keys[0]],
+	}, nil
+}
+
+var _ ptproc.Processor = (*fileProcessor)(nil)
+
+// fileProcessor delegates to the processor for each file.
+// files which are not target files are processed by fallback.
+type fileProcessor struct {
+	// procs are keyed by absolute paths of target files.
+	procs    map[string]ptproc.Processor
+	fallback ptproc.Processor
+}
+
+func (proc *fileProcessor) processorFor(filePath string) ptproc.Processor {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return proc.fallback
+	}
+	if p, ok := proc.procs[absPath]; ok {
+		return p
+	}
+	return proc.fallback
+}
+
+func (proc *fileProcessor) Parse(ctx context.Context, filePath string, r io.Reader) ([]ptproc.Node, error) {
+	return proc.processorFor(filePath).Parse(ctx, filePath, r)
+}
+
+func (proc *fileProcessor) Process(ctx context.Context, filePath string, r io.Reader) (string, error) {
+	return proc.processorFor(filePath).Process(ctx, filePath, r)
+}
+
+func (proc *fileProcessor) ProcessFile(ctx context.Context, filePath string) (string, error) {
+	return proc.processorFor(filePath).ProcessFile(ctx, filePath)
+}
+
+func (proc *fileProcessor) ProcessFileResult(ctx context.Context, filePath string) (*ptproc.Result, error) {
+	return proc.processorFor(filePath).ProcessFileResult(ctx, filePath)
+}
+
+func (proc *fileProcessor) WithRules(ctx context.Context, rules []ptproc.Rule) (ptproc.Processor, error) {
+	return proc.fallback.WithRules(ctx, rules)
+}
+
+func (proc *fileProcessor) RuleOptions(filePath string) *ptproc.RuleOptions {
+	return proc.processorFor(filePath).RuleOptions(filePath)
+}
+
+// showConfig prints the effective config for the file with config files used.
+func showConfig(cCtx *cli.Context, w io.Writer, filePath string) error {
+	ctx := cCtx.Context
+
+	cfgFiles, err := configFiles(cCtx, filePath)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := ptproc.LoadConfigs(ctx, cfgFiles)
+	if err != nil {
+		return err
+	}
+
+	b, err := yaml.MarshalContext(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	if len(cfgFiles) == 0 {
+		fmt.Fprintln(w, "# no config files. default config is used")
+	}
+	for _, cfgFile := range cfgFiles {
+		fmt.Fprintf(w, "# %s\n", cfgFile)
+	}
+	_, err = w.Write(b)
+	return err
+}
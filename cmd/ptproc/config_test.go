@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/urfave/cli/v2"
+)
+
+func Test_newProcessor(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	baseDir := t.TempDir()
+
+	files := map[string]string{
+		"re/ptproc.yaml": heredoc.Doc(`
+			mapfile:
+			  startRegExp: "^#@mapfile\\((.+)\\)\\s*$"
+			  endRegExp: "^#@end\\s*$"
+		`),
+		"re/doc.re": heredoc.Doc(`
+			#@mapfile(external.txt)
+			#@end
+		`),
+		"re/external.txt": "re\n",
+		"md/ptproc.yaml": heredoc.Doc(`
+			maprange:
+			  disableDedent: true
+		`),
+		"md/doc.md": heredoc.Doc(`
+			mapfile:external.txt
+			mapfile.end
+		`),
+		"md/external.txt": "md\n",
+	}
+	for name, s := range files {
+		filePath := filepath.Join(baseDir, name)
+		err := os.MkdirAll(filepath.Dir(filePath), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filePath, []byte(s), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.String("root", baseDir, "")
+	cCtx := cli.NewContext(cli.NewApp(), flagSet, nil)
+	cCtx.Context = ctx
+
+	// target files are specified as relative paths, but watch processes them by absolute paths.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var filePaths []string
+	for _, name := range []string{"re/doc.re", "md/doc.md"} {
+		s, err := filepath.Rel(wd, filepath.Join(baseDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		filePaths = append(filePaths, s)
+	}
+
+	proc, err := newProcessor(cCtx, filePaths)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, filePath := range filePaths {
+		absPath, err := filepath.Abs(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := filepath.Base(filepath.Dir(filePath)) + "\n"
+		for _, s := range []string{filePath, absPath} {
+			v, err := proc.ProcessFile(ctx, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(v, expected) {
+				t.Errorf("%s is not processed by its config: %s", s, v)
+			}
+		}
+	}
+}
+
+func Test_loadProcessorConfig_allowedDirs(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	baseDir := t.TempDir()
+	rootDir := filepath.Join(baseDir, "docs")
+
+	configFilePath := filepath.Join(baseDir, "ptproc.yaml")
+	err := os.WriteFile(configFilePath, []byte("allowedDirs:\n  - ./shared\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.String("root", rootDir, "")
+	cCtx := cli.NewContext(cli.NewApp(), flagSet, nil)
+	cCtx.Context = ctx
+
+	cfg, err := loadProcessorConfig(cCtx, []string{configFilePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Sandbox == nil {
+		t.Fatal("sandbox is expected")
+	}
+	if v := cfg.Sandbox.RootDir; v != rootDir {
+		t.Errorf("got = %v, want %v", v, rootDir)
+	}
+	expected := []string{filepath.Join(baseDir, "shared")}
+	if v := cfg.Sandbox.AllowedDirs; !reflect.DeepEqual(v, expected) {
+		t.Errorf("got = %v, want %v", v, expected)
+	}
+}
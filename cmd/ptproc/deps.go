@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/vvakame/ptproc"
+	"golang.org/x/sync/errgroup"
+)
+
+// writeDepfile writes Make-compatible dependency file of target files to depfilePath.
+func writeDepfile(ctx context.Context, proc ptproc.Processor, filePaths []string, depfilePath string) error {
+	var buf bytes.Buffer
+	err := writeDeps(ctx, &buf, proc, filePaths)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(depfilePath, buf.Bytes(), 0o644)
+}
+
+// writeDeps writes a Make rule for each target file.
+// prerequisites are files read by directives, including files reached through recursive embedding.
+// files read at a revision are omitted because they are not on the file system.
+func writeDeps(ctx context.Context, w io.Writer, proc ptproc.Processor, filePaths []string) error {
+	deps := make([][]string, len(filePaths))
+
+	var eg errgroup.Group
+	for idx, s := range filePaths {
+		idx := idx
+		s := s
+
+		eg.Go(func() error {
+			result, err := proc.ProcessFileResult(ctx, s)
+			if err != nil {
+				return err
+			}
+
+			for _, dep := range result.Dependencies {
+				if dep.Rev != "" {
+					continue
+				}
+				deps[idx] = append(deps[idx], dep.Path)
+			}
+
+			return nil
+		})
+	}
+
+	err := eg.Wait()
+	if err != nil {
+		return err
+	}
+
+	for idx, s := range filePaths {
+		_, err := fmt.Fprintf(w, "%s:", escapeMakePath(s))
+		if err != nil {
+			return err
+		}
+		for _, dep := range deps[idx] {
+			_, err = fmt.Fprintf(w, " %s", escapeMakePath(dep))
+			if err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintln(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// makePathReplacer escapes characters which have special meanings in Make rules.
+// "%" is not escaped because it is special only in pattern rules.
+var makePathReplacer = strings.NewReplacer(
+	" ", `\ `,
+	"#", `\#`,
+	"$", "$$",
+	":", `\:`,
+)
+
+// escapeMakePath escapes s as a target or a prerequisite of Make rules.
+func escapeMakePath(s string) string {
+	return makePathReplacer.Replace(s)
+}
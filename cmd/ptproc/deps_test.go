@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_escapeMakePath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		input  string
+		output string
+	}{
+		{
+			name:   "plain",
+			input:  "docs/index.md",
+			output: "docs/index.md",
+		},
+		{
+			name:   "space",
+			input:  "docs/my doc.md",
+			output: `docs/my\ doc.md`,
+		},
+		{
+			name:   "hash",
+			input:  "docs/#1.md",
+			output: `docs/\#1.md`,
+		},
+		{
+			name:   "dollar",
+			input:  "docs/$HOME.md",
+			output: "docs/$$HOME.md",
+		},
+		{
+			name:   "colon",
+			input:  "docs/a:b.md",
+			output: `docs/a\:b.md`,
+		},
+		{
+			name:   "percent",
+			input:  "docs/100%.md",
+			output: "docs/100%.md",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if v := escapeMakePath(tt.input); v != tt.output {
+				t.Errorf("got = %v, want %v", v, tt.output)
+			}
+		})
+	}
+}
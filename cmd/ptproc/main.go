@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/pmezard/go-difflib/difflib"
 	"github.com/urfave/cli/v2"
 	"github.com/vvakame/ptproc"
 	"golang.org/x/sync/errgroup"
@@ -62,70 +63,208 @@ func realMain() error {
 				DefaultText: "./ptproc.yaml",
 				Aliases:     []string{"c"},
 			},
+			&cli.StringFlag{
+				Name:  "root",
+				Usage: "project root directory. directives can't read files outside of it. overrides root in config file",
+			},
+			&cli.StringSliceFlag{
+				Name:    "include",
+				Usage:   "directory to search files of directives in. can be specified multiple times. searched before includePaths in config file",
+				Aliases: []string{"I"},
+			},
 			&cli.BoolFlag{
 				Name:    "replace",
 				Usage:   "write back result to source file instead of stdout",
 				Aliases: []string{"r"},
 			},
+			&cli.BoolFlag{
+				Name:  "check",
+				Usage: "check whether files are up to date. print diff and exit with non-zero status if not",
+			},
+			&cli.StringFlag{
+				Name:  "report",
+				Usage: "--report json. print report of directives in each file instead of results",
+			},
+			&cli.StringFlag{
+				Name:  "depfile",
+				Usage: "write Make-compatible dependency file of target files to specified path",
+			},
+			&cli.BoolFlag{
+				Name:    "watch",
+				Usage:   "watch target files and referenced files, and write back result when they are changed",
+				Aliases: []string{"w"},
+			},
 			&cli.StringFlag{
 				Name:    "glob",
 				Usage:   "specify target file by glob pattern. see https://pkg.go.dev/path/filepath#Glob",
 				Aliases: []string{"g"},
 			},
 		},
+		Commands: []*cli.Command{
+			{
+				Name:      "deps",
+				Usage:     "print Make-compatible dependencies of target files",
+				ArgsUsage: "[files...]",
+				Action: func(cCtx *cli.Context) error {
+					ctx := cCtx.Context
+
+					filePaths, err := targetFilePaths(cCtx, cCtx.Args().Slice())
+					if err != nil {
+						return err
+					}
+
+					proc, err := newProcessor(cCtx, filePaths)
+					if err != nil {
+						return err
+					}
+
+					return writeDeps(ctx, os.Stdout, proc, filePaths)
+				},
+			},
+			{
+				Name:      "refs",
+				Usage:     "print directives which refer to the file or the range in it",
+				ArgsUsage: "<file>[:range] [files...]",
+				Action: func(cCtx *cli.Context) error {
+					ctx := cCtx.Context
+
+					if cCtx.NArg() == 0 {
+						return errors.New("no referenced file specified")
+					}
+
+					filePaths, err := targetFilePaths(cCtx, cCtx.Args().Tail())
+					if err != nil {
+						return err
+					}
+
+					proc, err := newProcessor(cCtx, filePaths)
+					if err != nil {
+						return err
+					}
+
+					return printRefs(ctx, os.Stdout, proc, cCtx.Args().First(), filePaths)
+				},
+			},
+			{
+				Name:      "lint",
+				Usage:     "check directives of target files and range markers of files they refer to",
+				ArgsUsage: "[files...]",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "source",
+						Usage: "glob pattern of additional source files to check range markers",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					ctx := cCtx.Context
+
+					filePaths, err := targetFilePaths(cCtx, cCtx.Args().Slice())
+					if err != nil {
+						return err
+					}
+
+					var sourcePaths []string
+					for _, pattern := range cCtx.StringSlice("source") {
+						fs, err := filepath.Glob(pattern)
+						if err != nil {
+							return err
+						}
+						sourcePaths = append(sourcePaths, fs...)
+					}
+
+					proc, err := newProcessor(cCtx, filePaths)
+					if err != nil {
+						return err
+					}
+
+					diags, err := ptproc.Lint(ctx, proc, filePaths, sourcePaths)
+					if err != nil {
+						return err
+					}
+					for _, d := range diags {
+						fmt.Println(d)
+					}
+					if len(diags) != 0 {
+						return fmt.Errorf("%d problems are found", len(diags))
+					}
+
+					return nil
+				},
+			},
+			{
+				Name:  "config",
+				Usage: "inspect config files",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "show",
+						Usage:     "print the effective config for the file",
+						ArgsUsage: "<path>",
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.NArg() != 1 {
+								return errors.New("specify one path")
+							}
+
+							return showConfig(cCtx, os.Stdout, cCtx.Args().First())
+						},
+					},
+				},
+			},
+		},
 		Action: func(cCtx *cli.Context) error {
 			ctx := cCtx.Context
 
-			configFilePath := cCtx.String("config")
-			configFileSpecified := true
-			if configFilePath == "" {
-				configFilePath = "ptproc.yaml"
-				configFileSpecified = false
-			}
 			useReplace := cCtx.Bool("replace")
+			useCheck := cCtx.Bool("check")
+			useWatch := cCtx.Bool("watch")
+			reportFormat := cCtx.String("report")
+			depfilePath := cCtx.String("depfile")
 			globPattern := cCtx.String("glob")
 
-			var cfg *ptproc.ProcessorConfig
-			if rawCfg, err := ptproc.LoadConfig(ctx, configFilePath); !configFileSpecified && errors.Is(err, os.ErrNotExist) {
-				slog.DebugContext(ctx, "ptproc.yaml is not exists. ignored")
-				cfg = nil
-			} else if errors.Is(err, os.ErrNotExist) {
-				return fmt.Errorf("failed to load config file: %s, : %w", configFilePath, err)
-			} else if err != nil {
-				return err
-			} else {
-				cfg, err = rawCfg.ToProcessorConfig(ctx)
-				if err != nil {
-					return err
-				}
+			if useReplace && useCheck {
+				return errors.New("--replace and --check can't be used together")
+			}
+			if useWatch && useCheck {
+				return errors.New("--watch and --check can't be used together")
+			}
+			if reportFormat != "" && reportFormat != "json" {
+				return fmt.Errorf("unknown report format: %s", reportFormat)
+			}
+			if useWatch && reportFormat != "" {
+				return errors.New("--watch and --report can't be used together")
+			}
+			if useWatch && depfilePath != "" {
+				return errors.New("--watch and --depfile can't be used together")
 			}
 
-			slog.DebugContext(ctx, "start processing", slog.Bool("replace", useReplace), slog.String("glob", globPattern))
+			slog.DebugContext(ctx, "start processing", slog.Bool("replace", useReplace), slog.Bool("check", useCheck), slog.Bool("watch", useWatch), slog.String("report", reportFormat), slog.String("depfile", depfilePath), slog.String("glob", globPattern))
 
-			var filePaths []string
+			filePaths, err := targetFilePaths(cCtx, cCtx.Args().Slice())
+			if err != nil {
+				return err
+			}
+
+			slog.DebugContext(ctx, "target files", "filePaths", filePaths)
 
-			if fs := cCtx.Args().Slice(); len(fs) != 0 {
-				filePaths = append(filePaths, fs...)
+			proc, err := newProcessor(cCtx, filePaths)
+			if err != nil {
+				return err
 			}
 
-			if globPattern != "" {
-				fs, err := filepath.Glob(globPattern)
+			if depfilePath != "" {
+				err = writeDepfile(ctx, proc, filePaths, depfilePath)
 				if err != nil {
 					return err
 				}
-
-				filePaths = append(filePaths, fs...)
 			}
 
-			if len(filePaths) == 0 {
-				return errors.New("no files specified")
+			if reportFormat != "" {
+				return reportFiles(ctx, proc, filePaths, useReplace, useCheck)
 			}
-
-			slog.DebugContext(ctx, "target files", "filePaths", filePaths)
-
-			proc, err := ptproc.NewProcessor(cfg)
-			if err != nil {
-				return err
+			if useCheck {
+				return checkFiles(ctx, proc, filePaths)
+			}
+			if useWatch {
+				return watchFiles(ctx, proc, filePaths)
 			}
 
 			var eg errgroup.Group
@@ -158,7 +297,7 @@ func realMain() error {
 						return err
 					}
 
-					fmt.Println(result)
+					fmt.Print(result)
 				}
 			}
 
@@ -178,6 +317,93 @@ func realMain() error {
 	return nil
 }
 
+// targetFilePaths returns files specified by args and --glob flag.
+func targetFilePaths(cCtx *cli.Context, args []string) ([]string, error) {
+	var filePaths []string
+
+	filePaths = append(filePaths, args...)
+
+	if globPattern := cCtx.String("glob"); globPattern != "" {
+		fs, err := filepath.Glob(globPattern)
+		if err != nil {
+			return nil, err
+		}
+
+		filePaths = append(filePaths, fs...)
+	}
+
+	if len(filePaths) == 0 {
+		return nil, errors.New("no files specified")
+	}
+
+	return filePaths, nil
+}
+
+func checkFiles(ctx context.Context, proc ptproc.Processor, filePaths []string) error {
+	diffs := make([]string, len(filePaths))
+
+	var eg errgroup.Group
+	for idx, s := range filePaths {
+		idx := idx
+		s := s
+
+		eg.Go(func() error {
+			slog.DebugContext(ctx, "check file", slog.String("file", s))
+
+			result, err := proc.ProcessFile(ctx, s)
+			if err != nil {
+				return err
+			}
+
+			b, err := os.ReadFile(s)
+			if err != nil {
+				return err
+			}
+
+			if string(b) == result {
+				return nil
+			}
+
+			diff := difflib.UnifiedDiff{
+				A:        difflib.SplitLines(string(b)),
+				B:        difflib.SplitLines(result),
+				FromFile: s,
+				ToFile:   s,
+				Context:  5,
+			}
+			d, err := difflib.GetUnifiedDiffString(diff)
+			if err != nil {
+				return err
+			}
+			diffs[idx] = d
+
+			return nil
+		})
+	}
+
+	err := eg.Wait()
+	if err != nil {
+		return err
+	}
+
+	var outdated int
+	for _, d := range diffs {
+		if d == "" {
+			continue
+		}
+		outdated++
+		fmt.Print(d)
+	}
+
+	if outdated != 0 {
+		return fmt.Errorf("%d of %d files are not up to date", outdated, len(filePaths))
+	}
+
+	slog.InfoContext(ctx, "all files are up to date", slog.Int("files", len(filePaths)))
+
+	return nil
+}
+
 func setDefaultLoggerWithLevel(level slog.Leveler) {
 	h := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
 		Level: level,
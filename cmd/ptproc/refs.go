@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vvakame/ptproc"
+)
+
+// directiveTarget returns the file and the range name or symbol referred by the directive node.
+func directiveTarget(n ptproc.Node) (file string, name string, ok bool) {
+	switch n := n.(type) {
+	case *ptproc.MapFileNode:
+		return n.Params.File, "", true
+	case *ptproc.MapRangeNode:
+		return n.Params.File, n.Params.Name, true
+	case *ptproc.MapSymbolNode:
+		return n.Params.File, n.Params.Symbol, true
+	default:
+		return "", "", false
+	}
+}
+
+// printRefs prints directives in target files which refer to ref.
+// ref is a file path or "file:range" to match maprange directives of the range only.
+func printRefs(ctx context.Context, w io.Writer, proc ptproc.Processor, ref string, filePaths []string) error {
+	refFile, refRange := splitRef(ref)
+	refFile, err := filepath.Abs(refFile)
+	if err != nil {
+		return err
+	}
+
+	for _, filePath := range filePaths {
+		b, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+
+		ns, err := proc.Parse(ctx, filePath, bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+
+		opts := proc.RuleOptions(filePath)
+		for _, n := range ns {
+			file, name, ok := directiveTarget(n)
+			if !ok {
+				continue
+			}
+			if _, ok := n.(*ptproc.MapRangeNode); refRange != "" && (!ok || name != refRange) {
+				continue
+			}
+
+			s, err := filepath.Abs(opts.FilePath(file))
+			if err != nil {
+				return err
+			}
+			if s != refFile {
+				continue
+			}
+
+			_, err = fmt.Fprintf(w, "%s:%d: %s\n", filePath, n.Line(), directiveText(n))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// splitRef splits "file:range" into the file and the range. the range is empty if ref is an existing file.
+func splitRef(ref string) (string, string) {
+	if _, err := os.Stat(ref); err == nil {
+		return ref, ""
+	}
+
+	idx := strings.LastIndex(ref, ":")
+	if idx == -1 || strings.ContainsAny(ref[idx+1:], `/\`) {
+		return ref, ""
+	}
+	// the colon of the drive letter on Windows. e.g. `C:main.go`
+	if idx < len(filepath.VolumeName(ref)) {
+		return ref, ""
+	}
+
+	return ref[:idx], ref[idx+1:]
+}
+
+func directiveText(n ptproc.Node) string {
+	switch n := n.(type) {
+	case *ptproc.MapFileNode:
+		return n.Directive
+	case *ptproc.MapRangeNode:
+		return n.Directive
+	case *ptproc.MapSymbolNode:
+		return n.Directive
+	default:
+		return ""
+	}
+}
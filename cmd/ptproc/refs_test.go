@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func Test_splitRef(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	colonFile := filepath.Join(dir, "a:b.txt")
+	if runtime.GOOS != "windows" {
+		err := os.WriteFile(colonFile, nil, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		input     string
+		file      string
+		rangeName string
+		skip      bool
+	}{
+		{
+			name:  "file",
+			input: "src/main.go",
+			file:  "src/main.go",
+		},
+		{
+			name:      "file and range",
+			input:     "src/main.go:targetB",
+			file:      "src/main.go",
+			rangeName: "targetB",
+		},
+		{
+			name:  "colon in directory",
+			input: "src/a:b/main.go",
+			file:  "src/a:b/main.go",
+		},
+		{
+			name:  "existing file with colon",
+			input: colonFile,
+			file:  colonFile,
+			skip:  runtime.GOOS == "windows",
+		},
+		{
+			name:      "existing file with colon and range",
+			input:     colonFile + ":targetB",
+			file:      colonFile,
+			rangeName: "targetB",
+			skip:      runtime.GOOS == "windows",
+		},
+		{
+			name:  "windows drive letter",
+			input: `C:\src\main.go`,
+			file:  `C:\src\main.go`,
+		},
+		{
+			name:      "windows drive letter and range",
+			input:     `C:\src\main.go:targetB`,
+			file:      `C:\src\main.go`,
+			rangeName: "targetB",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if tt.skip {
+				t.Skip("file names can't contain colons")
+			}
+
+			file, rangeName := splitRef(tt.input)
+			if file != tt.file {
+				t.Errorf("got = %v, want %v", file, tt.file)
+			}
+			if rangeName != tt.rangeName {
+				t.Errorf("got = %v, want %v", rangeName, tt.rangeName)
+			}
+		})
+	}
+}
+
+func Test_splitRef_windowsDriveRelative(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS != "windows" {
+		t.Skip("drive letters are only on windows")
+	}
+
+	file, rangeName := splitRef("C:main.go")
+	if file != "C:main.go" || rangeName != "" {
+		t.Errorf("unexpected result: %s, %s", file, rangeName)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/vvakame/ptproc"
+	"golang.org/x/sync/errgroup"
+)
+
+type report struct {
+	Files []*fileReport `json:"files"`
+}
+
+type fileReport struct {
+	File        string             `json:"file"`
+	Changed     bool               `json:"changed"`
+	Error       string             `json:"error,omitempty"`
+	Directives  []*directiveReport `json:"directives"`
+	Diagnostics []string           `json:"diagnostics,omitempty"`
+}
+
+type directiveReport struct {
+	Kind         string `json:"kind"`
+	Line         int    `json:"line"`
+	File         string `json:"file"`
+	ResolvedPath string `json:"resolvedPath,omitempty"`
+	Name         string `json:"name,omitempty"`
+	LinesBefore  int    `json:"linesBefore"`
+	LinesAfter   int    `json:"linesAfter"`
+	Changed      bool   `json:"changed"`
+	Error        string `json:"error,omitempty"`
+}
+
+// reportFiles processes files and prints the report as JSON.
+// errors of each file are included in the report instead of stopping processing.
+func reportFiles(ctx context.Context, proc ptproc.Processor, filePaths []string, useReplace bool, useCheck bool) error {
+	rep := &report{
+		Files: make([]*fileReport, len(filePaths)),
+	}
+
+	var eg errgroup.Group
+	for idx, s := range filePaths {
+		idx := idx
+		s := s
+
+		eg.Go(func() error {
+			slog.DebugContext(ctx, "report file", slog.String("file", s))
+
+			fileRep := &fileReport{
+				File:       s,
+				Directives: []*directiveReport{},
+			}
+			rep.Files[idx] = fileRep
+
+			result, err := proc.ProcessFileResult(ctx, s)
+			if err != nil {
+				fileRep.Error = err.Error()
+			}
+			if result == nil {
+				return nil
+			}
+
+			for _, d := range result.Directives {
+				dRep := &directiveReport{
+					Kind:         d.Kind,
+					Line:         d.Line,
+					File:         d.File,
+					ResolvedPath: d.ResolvedPath,
+					Name:         d.Name,
+					LinesBefore:  d.LinesBefore,
+					LinesAfter:   d.LinesAfter,
+					Changed:      d.Changed,
+				}
+				if d.Err != nil {
+					dRep.Error = d.Err.Error()
+				}
+				fileRep.Directives = append(fileRep.Directives, dRep)
+			}
+			if err != nil {
+				return nil
+			}
+
+			for _, d := range result.Diagnostics {
+				fileRep.Diagnostics = append(fileRep.Diagnostics, d.String())
+			}
+			fileRep.Changed = result.Changed
+
+			if useReplace && fileRep.Changed {
+				err = os.WriteFile(s, []byte(result.Output), 0o644)
+				if err != nil {
+					return err
+				}
+
+				slog.InfoContext(ctx, "file has been replaced", slog.String("file", s))
+			}
+
+			return nil
+		})
+	}
+
+	err := eg.Wait()
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(rep)
+	if err != nil {
+		return err
+	}
+
+	var failed, outdated int
+	for _, fileRep := range rep.Files {
+		if fileRep.Error != "" {
+			failed++
+		} else if fileRep.Changed {
+			outdated++
+		}
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("%d of %d files failed to process", failed, len(filePaths))
+	}
+	if useCheck && outdated != 0 {
+		return fmt.Errorf("%d of %d files are not up to date", outdated, len(filePaths))
+	}
+
+	return nil
+}
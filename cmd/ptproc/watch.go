@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/vvakame/ptproc"
+)
+
+const watchDebounce = 200 * time.Millisecond
+
+type watcher struct {
+	proc ptproc.Processor
+	fsw  *fsnotify.Watcher
+
+	// targets are absolute paths of target documents.
+	targets []string
+	// deps holds absolute paths of external files referenced by each target.
+	deps        map[string][]string
+	watchedDirs map[string]bool
+}
+
+// watchFiles processes target files and reprocesses them when targets or referenced external files are changed.
+func watchFiles(ctx context.Context, proc ptproc.Processor, filePaths []string) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := fsw.Close()
+		if err != nil {
+			slog.ErrorContext(ctx, "watcher close", "err", err)
+		}
+	}()
+
+	w := &watcher{
+		proc:        proc,
+		fsw:         fsw,
+		deps:        make(map[string][]string),
+		watchedDirs: make(map[string]bool),
+	}
+
+	for _, s := range filePaths {
+		s, err := filepath.Abs(s)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(w.targets, s) {
+			continue
+		}
+		w.targets = append(w.targets, s)
+	}
+
+	for _, s := range w.targets {
+		w.processFile(ctx, s)
+	}
+
+	slog.InfoContext(ctx, "watching files", slog.Int("targets", len(w.targets)))
+
+	pending := make(map[string]bool)
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case ev, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			if !ev.Has(fsnotify.Write) && !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Rename) && !ev.Has(fsnotify.Remove) {
+				continue
+			}
+
+			filePath, err := filepath.Abs(ev.Name)
+			if err != nil {
+				return err
+			}
+			for _, s := range w.affectedTargets(filePath) {
+				slog.DebugContext(ctx, "file changed", slog.String("file", filePath), slog.String("target", s))
+				pending[s] = true
+			}
+			if len(pending) != 0 {
+				timer.Reset(watchDebounce)
+			}
+
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			slog.ErrorContext(ctx, "watcher error", "err", err)
+
+		case <-timer.C:
+			for _, s := range w.targets {
+				if !pending[s] {
+					continue
+				}
+				w.processFile(ctx, s)
+			}
+			clear(pending)
+		}
+	}
+}
+
+// affectedTargets returns targets which should be reprocessed when filePath is changed.
+func (w *watcher) affectedTargets(filePath string) []string {
+	var targets []string
+	for _, s := range w.targets {
+		if s == filePath || slices.Contains(w.deps[s], filePath) {
+			targets = append(targets, s)
+		}
+	}
+	return targets
+}
+
+// processFile replaces the target file and updates its dependencies.
+// errors are logged instead of returned to keep watching.
+func (w *watcher) processFile(ctx context.Context, filePath string) {
+	result, err := w.proc.ProcessFileResult(ctx, filePath)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to process file", slog.String("file", filePath), "err", err)
+	} else if result.Changed {
+		err = os.WriteFile(filePath, []byte(result.Output), 0o644)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to write file", slog.String("file", filePath), "err", err)
+		} else {
+			slog.InfoContext(ctx, "file has been replaced", slog.String("file", filePath))
+		}
+	}
+
+	// keep previous dependencies if the file can't be processed at all.
+	if result != nil {
+		deps, err := w.dependencies(result)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to collect dependencies", slog.String("file", filePath), "err", err)
+		} else {
+			w.deps[filePath] = deps
+		}
+	}
+
+	for _, s := range append([]string{filePath}, w.deps[filePath]...) {
+		dir := filepath.Dir(s)
+		if w.watchedDirs[dir] {
+			continue
+		}
+
+		// watch directories instead of files. editors often replace files by rename.
+		err := w.fsw.Add(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			slog.ErrorContext(ctx, "failed to watch directory", slog.String("dir", dir), "err", err)
+			continue
+		}
+		w.watchedDirs[dir] = true
+	}
+}
+
+// dependencies returns absolute paths of external files read while processing, including files read by recursive embedding.
+// files referenced by directives are included even if they don't exist yet.
+func (w *watcher) dependencies(result *ptproc.Result) ([]string, error) {
+	var deps []string
+	add := func(s string) error {
+		s, err := filepath.Abs(s)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(deps, s) {
+			deps = append(deps, s)
+		}
+		return nil
+	}
+
+	for _, d := range result.Directives {
+		if d.ResolvedPath == "" {
+			continue
+		}
+		err := add(d.ResolvedPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, dep := range result.Dependencies {
+		if dep.Rev != "" {
+			// the file at the revision doesn't change.
+			continue
+		}
+		err := add(dep.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return deps, nil
+}
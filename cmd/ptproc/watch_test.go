@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/vvakame/ptproc"
+)
+
+func Test_watcher_dependencies(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	baseDir := t.TempDir()
+
+	files := map[string]string{
+		"doc.md": heredoc.Doc(`
+			mapfile:file:"a.txt",recursive:true
+			mapfile.end
+			mapfile:missing.txt
+			mapfile.end
+		`),
+		"a.txt": heredoc.Doc(`
+			mapfile:b.txt
+			mapfile.end
+		`),
+		"b.txt": "b\n",
+	}
+	for name, s := range files {
+		err := os.WriteFile(filepath.Join(baseDir, name), []byte(s), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	proc, err := ptproc.NewProcessor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, _ := proc.ProcessFileResult(ctx, filepath.Join(baseDir, "doc.md"))
+	if result == nil {
+		t.Fatal("result is nil")
+	}
+
+	w := &watcher{proc: proc}
+	deps, err := w.dependencies(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		filepath.Join(baseDir, "a.txt"),
+		filepath.Join(baseDir, "missing.txt"),
+		filepath.Join(baseDir, "b.txt"),
+	}
+	if !reflect.DeepEqual(deps, expected) {
+		t.Errorf("got = %v, want %v", deps, expected)
+	}
+}
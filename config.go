@@ -2,22 +2,53 @@ package ptproc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
 
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	cueerrors "cuelang.org/go/cue/errors"
 	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/parser"
 	"go.opentelemetry.io/otel"
 )
 
 var _ slog.LogValuer = (*Config)(nil)
 var _ slog.LogValuer = (*MapfileDirective)(nil)
 var _ slog.LogValuer = (*MaprangeDirective)(nil)
+var _ slog.LogValuer = (*MapsymbolDirective)(nil)
+var _ slog.LogValuer = (*CustomDirective)(nil)
 
 type Config struct {
-	Mapfile  *MapfileDirective  `yaml:"mapfile"`
-	Maprange *MaprangeDirective `yaml:"maprange"`
+	// Root is the project root directory. directives can't read files outside of it if specified.
+	// relative path is resolved from the directory of the config file.
+	Root string `yaml:"root,omitempty"`
+	// AllowedDirs are additional directories directives can read. it restricts files like Root.
+	AllowedDirs []string `yaml:"allowedDirs,omitempty"`
+	// IncludePaths are searched in order when the file of a directive is not found relative to the document.
+	// relative path is resolved from the directory of the config file.
+	IncludePaths []string `yaml:"includePaths,omitempty"`
+	// CacheDir stores contents of files read at a revision by `rev` param of directives.
+	// relative path is resolved from the directory of the config file.
+	CacheDir string `yaml:"cacheDir,omitempty"`
+
+	Mapfile   *MapfileDirective   `yaml:"mapfile"`
+	Maprange  *MaprangeDirective  `yaml:"maprange"`
+	Mapsymbol *MapsymbolDirective `yaml:"mapsymbol"`
+	// Directives are additional directives. they are applied after mapfile, maprange and mapsymbol in order.
+	Directives []*CustomDirective `yaml:"directives,omitempty"`
+	// FileTypes are directive sets for files matched by patterns. the first matched one is used.
+	FileTypes []*FileType `yaml:"fileTypes,omitempty"`
+
+	// baseDir is the directory of the config file.
+	baseDir string
 }
 
 type MapfileDirective struct {
@@ -26,6 +57,8 @@ type MapfileDirective struct {
 	DisableRewriteIndent bool   `yaml:"disableRewriteIndent"`
 	IndentWidth          int    `yaml:"indentWidth"`
 	DefaultSkip          int    `yaml:"defaultSkip"`
+	Recursive            bool   `yaml:"recursive"`
+	MaxDepth             int    `yaml:"maxDepth"`
 }
 
 type MaprangeDirective struct {
@@ -37,6 +70,48 @@ type MaprangeDirective struct {
 	DefaultSkip          int    `yaml:"defaultSkip"`
 }
 
+type MapsymbolDirective struct {
+	StartRegExp          string `yaml:"startRegExp"`
+	EndRegExp            string `yaml:"endRegExp"`
+	DisableDedent        bool   `yaml:"disableDedent"`
+	DisableRewriteIndent bool   `yaml:"disableRewriteIndent"`
+	IndentWidth          int    `yaml:"indentWidth"`
+	DefaultSkip          int    `yaml:"defaultSkip"`
+}
+
+// FileType is a directive set for files matched by Patterns.
+// omitted directives are inherited from the top level of the config.
+type FileType struct {
+	// Patterns are glob patterns. e.g. "*.md" or ".md" for the extension.
+	// patterns contain "/" are matched with the slash separated path relative to the config file, others are matched with the file name.
+	Patterns   []string            `yaml:"patterns"`
+	Mapfile    *MapfileDirective   `yaml:"mapfile,omitempty"`
+	Maprange   *MaprangeDirective  `yaml:"maprange,omitempty"`
+	Mapsymbol  *MapsymbolDirective `yaml:"mapsymbol,omitempty"`
+	Directives []*CustomDirective  `yaml:"directives,omitempty"`
+}
+
+// CustomDirective is a named directive with its own regexps.
+type CustomDirective struct {
+	Name string `yaml:"name"`
+	// Kind is one of "file", "range", "lines" and "symbol".
+	// "lines" is "file" with the short form "file,lines". e.g. `main.go,10-25`.
+	Kind        string `yaml:"kind"`
+	StartRegExp string `yaml:"startRegExp"`
+	EndRegExp   string `yaml:"endRegExp"`
+	DefaultSkip int    `yaml:"defaultSkip"`
+	// PostProcess is applied to embedded content in order.
+	PostProcess []*PostProcessStep `yaml:"postProcess"`
+}
+
+// PostProcessStep is a step of post-processing of embedded content.
+type PostProcessStep struct {
+	// Type is "dedent" or "reindent".
+	Type string `yaml:"type"`
+	// IndentWidth is the indent width of reindent. 2 is used if 0.
+	IndentWidth int `yaml:"indentWidth,omitempty"`
+}
+
 func LoadConfig(ctx context.Context, filePath string) (_ *Config, err error) {
 	ctx, span := otel.Tracer("ptproc").Start(ctx, "LoadConfig")
 	defer func() {
@@ -46,12 +121,14 @@ func LoadConfig(ctx context.Context, filePath string) (_ *Config, err error) {
 		span.End()
 	}()
 
-	b, err := os.ReadFile(filePath)
+	b, err := readConfigFile(filePath)
 	if err != nil {
 		return nil, err
 	}
 
-	cfg := &Config{}
+	cfg := &Config{
+		baseDir: filepath.Dir(filePath),
+	}
 	err = yaml.UnmarshalContext(ctx, b, cfg)
 	if err != nil {
 		return nil, err
@@ -67,10 +144,85 @@ func LoadConfig(ctx context.Context, filePath string) (_ *Config, err error) {
 	return cfg, nil
 }
 
+// readConfigFile reads the config file and validates it by the schema.
+// files with .cue extension are evaluated as CUE, others are parsed as YAML.
+// returns the content as YAML.
+func readConfigFile(filePath string) ([]byte, error) {
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	cuectx := cuecontext.New()
+
+	if filepath.Ext(filePath) == ".cue" {
+		v := cuectx.CompileBytes(b, cue.Filename(filePath))
+		if err := v.Err(); err != nil {
+			return nil, errors.New(cueerrors.Details(err, nil))
+		}
+
+		v, err = validateSchema(lookupSchema(cuectx, "Config"), "Config", v, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		// JSON is also YAML.
+		return v.MarshalJSON()
+	}
+
+	f, err := parser.ParseBytes(b, 0)
+	if err != nil {
+		return nil, err
+	}
+	var m any
+	err = yaml.Unmarshal(b, &m)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		// the file is empty.
+		return b, nil
+	}
+
+	_, err = validateSchema(lookupSchema(cuectx, "Config"), "Config", cuectx.Encode(dropNullValues(m)), yamlPosition(filePath, f))
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// dropNullValues removes keys with null values from YAML maps.
+// keys like `mapfile:` with all children commented out are the same as omitted keys.
+func dropNullValues(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if value == nil {
+				delete(v, key)
+				continue
+			}
+			v[key] = dropNullValues(value)
+		}
+	case []any:
+		for idx, value := range v {
+			v[idx] = dropNullValues(value)
+		}
+	}
+	return v
+}
+
 func (cfg *Config) LogValue() slog.Value {
 	return slog.GroupValue(
+		slog.String("root", cfg.Root),
+		slog.Any("allowedDirs", cfg.AllowedDirs),
+		slog.Any("includePaths", cfg.IncludePaths),
+		slog.String("cacheDir", cfg.CacheDir),
 		slog.Any("mapfile", cfg.Mapfile),
 		slog.Any("maprange", cfg.Maprange),
+		slog.Any("mapsymbol", cfg.Mapsymbol),
+		slog.Any("directives", cfg.Directives),
+		slog.Int("fileTypes", len(cfg.FileTypes)),
 	)
 }
 
@@ -82,12 +234,92 @@ func (cfg *Config) fillByDefault() error {
 			DisableRewriteIndent: false,
 			IndentWidth:          0,
 			DefaultSkip:          0,
+			Recursive:            false,
+			MaxDepth:             0,
+		}
+	}
+	err := cfg.Mapfile.fillByDefault()
+	if err != nil {
+		return err
+	}
+
+	if cfg.Maprange == nil {
+		cfg.Maprange = &MaprangeDirective{
+			StartRegExp:          "",
+			EndRegExp:            "",
+			DisableDedent:        false,
+			DisableRewriteIndent: false,
+			IndentWidth:          0,
+			DefaultSkip:          0,
+		}
+	}
+	err = cfg.Maprange.fillByDefault()
+	if err != nil {
+		return err
+	}
+
+	if cfg.Mapsymbol == nil {
+		cfg.Mapsymbol = &MapsymbolDirective{
+			StartRegExp:          "",
+			EndRegExp:            "",
+			DisableDedent:        false,
+			DisableRewriteIndent: false,
+			IndentWidth:          0,
+			DefaultSkip:          0,
+		}
+	}
+	err = cfg.Mapsymbol.fillByDefault()
+	if err != nil {
+		return err
+	}
+
+	err = fillCustomDirectivesByDefault(cfg.Directives)
+	if err != nil {
+		return err
+	}
+
+	for idx, ft := range cfg.FileTypes {
+		if ft == nil || len(ft.Patterns) == 0 {
+			return fmt.Errorf("fileTypes[%d] patterns are required", idx)
+		}
+		for _, pattern := range ft.Patterns {
+			_, err := path.Match(pattern, "")
+			if err != nil {
+				return fmt.Errorf("fileTypes[%d] pattern %q is invalid: %w", idx, pattern, err)
+			}
+		}
+		if ft.Mapfile != nil {
+			err = ft.Mapfile.fillByDefault()
+			if err != nil {
+				return err
+			}
+		}
+		if ft.Maprange != nil {
+			err = ft.Maprange.fillByDefault()
+			if err != nil {
+				return err
+			}
+		}
+		if ft.Mapsymbol != nil {
+			err = ft.Mapsymbol.fillByDefault()
+			if err != nil {
+				return err
+			}
+		}
+		err = fillCustomDirectivesByDefault(ft.Directives)
+		if err != nil {
+			return err
 		}
 	}
-	if cfg.Mapfile.StartRegExp == "" {
-		cfg.Mapfile.StartRegExp = DefaultMapfileStartRegEx.String()
+
+	return nil
+}
+
+func (d *MapfileDirective) fillByDefault() error {
+	if d.StartRegExp == "" {
+		d.StartRegExp = DefaultMapfileStartRegEx.String()
 	} else {
-		re, err := regexp.Compile(cfg.Mapfile.StartRegExp)
+		re, err := regexp.Compile(d.StartRegExp)
 		if err != nil {
 			return fmt.Errorf("mapfile start regexp compile failed: %w", err)
 		}
@@ -95,32 +327,29 @@ func (cfg *Config) fillByDefault() error {
 			return fmt.Errorf("mapfile start regexp doesn't satisfied restriction")
 		}
 	}
-	if cfg.Mapfile.EndRegExp == "" {
-		cfg.Mapfile.EndRegExp = DefaultMapfileEndRegEx.String()
+	if d.EndRegExp == "" {
+		d.EndRegExp = DefaultMapfileEndRegEx.String()
 	} else {
-		_, err := regexp.Compile(cfg.Mapfile.EndRegExp)
+		_, err := regexp.Compile(d.EndRegExp)
 		if err != nil {
 			return fmt.Errorf("mapfile end regexp compile failed: %w", err)
 		}
 	}
-	if cfg.Mapfile.IndentWidth == 0 {
-		cfg.Mapfile.IndentWidth = 2
+	if d.IndentWidth == 0 {
+		d.IndentWidth = 2
 	}
-
-	if cfg.Maprange == nil {
-		cfg.Maprange = &MaprangeDirective{
-			StartRegExp:          "",
-			EndRegExp:            "",
-			DisableDedent:        false,
-			DisableRewriteIndent: false,
-			IndentWidth:          0,
-			DefaultSkip:          0,
-		}
+	if d.MaxDepth == 0 {
+		d.MaxDepth = DefaultMaxDepth
 	}
-	if cfg.Maprange.StartRegExp == "" {
-		cfg.Maprange.StartRegExp = DefaultMaprangeStartRegEx.String()
+
+	return nil
+}
+
+func (d *MaprangeDirective) fillByDefault() error {
+	if d.StartRegExp == "" {
+		d.StartRegExp = DefaultMaprangeStartRegEx.String()
 	} else {
-		re, err := regexp.Compile(cfg.Maprange.StartRegExp)
+		re, err := regexp.Compile(d.StartRegExp)
 		if err != nil {
 			return fmt.Errorf("maprange start regexp compile failed: %w", err)
 		}
@@ -128,120 +357,454 @@ func (cfg *Config) fillByDefault() error {
 			return fmt.Errorf("maprange start regexp doesn't satisfied restriction")
 		}
 	}
-	if cfg.Maprange.EndRegExp == "" {
-		cfg.Maprange.EndRegExp = DefaultMaprangeEndRegEx.String()
+	if d.EndRegExp == "" {
+		d.EndRegExp = DefaultMaprangeEndRegEx.String()
 	} else {
-		_, err := regexp.Compile(cfg.Maprange.EndRegExp)
+		_, err := regexp.Compile(d.EndRegExp)
 		if err != nil {
 			return fmt.Errorf("maprange end regexp compile failed: %w", err)
 		}
 	}
-	if cfg.Maprange.IndentWidth == 0 {
-		cfg.Maprange.IndentWidth = 2
+	if d.IndentWidth == 0 {
+		d.IndentWidth = 2
 	}
 
 	return nil
 }
 
-func (cfg *Config) ToProcessorConfig(ctx context.Context) (_ *ProcessorConfig, err error) {
-	var rules []Rule
-	{
-		var mapfileStartRegExp *regexp.Regexp
-		if v := cfg.Mapfile.StartRegExp; v != "" {
-			mapfileStartRegExp, err = regexp.Compile(v)
-			if err != nil {
-				return nil, fmt.Errorf("mapfile.startRegExp compile failed: %w", err)
-			}
+func (d *MapsymbolDirective) fillByDefault() error {
+	if d.StartRegExp == "" {
+		d.StartRegExp = DefaultMapsymbolStartRegEx.String()
+	} else {
+		re, err := regexp.Compile(d.StartRegExp)
+		if err != nil {
+			return fmt.Errorf("mapsymbol start regexp compile failed: %w", err)
 		}
-		var mapfileEndRegExp *regexp.Regexp
-		if v := cfg.Mapfile.EndRegExp; v != "" {
-			mapfileEndRegExp, err = regexp.Compile(v)
-			if err != nil {
-				return nil, fmt.Errorf("mapfile.endRegExp compile failed: %w", err)
-			}
+		if len(re.SubexpNames()) != 2 {
+			return fmt.Errorf("mapsymbol start regexp doesn't satisfied restriction")
+		}
+	}
+	if d.EndRegExp == "" {
+		d.EndRegExp = DefaultMapsymbolEndRegEx.String()
+	} else {
+		_, err := regexp.Compile(d.EndRegExp)
+		if err != nil {
+			return fmt.Errorf("mapsymbol end regexp compile failed: %w", err)
 		}
+	}
+	if d.IndentWidth == 0 {
+		d.IndentWidth = 2
+	}
 
-		var embedRules []Rule
-		if !cfg.Mapfile.DisableRewriteIndent {
-			rule, err := NewReindentRule(&ReindentRuleConfig{
-				IndentLevel: cfg.Mapfile.IndentWidth,
-			})
-			if err != nil {
-				return nil, err
+	return nil
+}
+
+func fillCustomDirectivesByDefault(ds []*CustomDirective) error {
+	var names []string
+	for idx, d := range ds {
+		if d == nil {
+			return fmt.Errorf("directives[%d] is empty", idx)
+		}
+		if d.Name == "" {
+			return fmt.Errorf("directives[%d] name is required", idx)
+		}
+		if slices.Contains(names, d.Name) {
+			return fmt.Errorf("%s directive is duplicated", d.Name)
+		}
+		names = append(names, d.Name)
+
+		switch d.Kind {
+		case "file", "range", "lines", "symbol":
+		default:
+			return fmt.Errorf("%s directive has unknown kind: %s", d.Name, d.Kind)
+		}
+		if d.StartRegExp == "" || d.EndRegExp == "" {
+			return fmt.Errorf("%s directive requires start and end regexp", d.Name)
+		}
+		re, err := regexp.Compile(d.StartRegExp)
+		if err != nil {
+			return fmt.Errorf("%s start regexp compile failed: %w", d.Name, err)
+		}
+		if len(re.SubexpNames()) != 2 {
+			return fmt.Errorf("%s start regexp doesn't satisfied restriction", d.Name)
+		}
+		_, err = regexp.Compile(d.EndRegExp)
+		if err != nil {
+			return fmt.Errorf("%s end regexp compile failed: %w", d.Name, err)
+		}
+
+		for _, step := range d.PostProcess {
+			switch step.Type {
+			case "dedent":
+			case "reindent":
+				if step.IndentWidth == 0 {
+					step.IndentWidth = 2
+				}
+			default:
+				return fmt.Errorf("%s directive has unknown post process: %s", d.Name, step.Type)
 			}
+		}
+	}
+
+	return nil
+}
+
+func (cfg *Config) ToProcessorConfig(ctx context.Context) (_ *ProcessorConfig, err error) {
+	rules, err := buildRules(cfg.Mapfile, cfg.Maprange, cfg.Mapsymbol, cfg.Directives)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileRules []*FileRules
+	for _, ft := range cfg.FileTypes {
+		ft := ft
+
+		mapfile := cfg.Mapfile
+		if ft.Mapfile != nil {
+			mapfile = ft.Mapfile
+		}
+		maprange := cfg.Maprange
+		if ft.Maprange != nil {
+			maprange = ft.Maprange
+		}
+		mapsymbol := cfg.Mapsymbol
+		if ft.Mapsymbol != nil {
+			mapsymbol = ft.Mapsymbol
+		}
+		directives := cfg.Directives
+		if ft.Directives != nil {
+			directives = ft.Directives
+		}
 
-			embedRules = append(embedRules, rule)
+		rules, err := buildRules(mapfile, maprange, mapsymbol, directives)
+		if err != nil {
+			return nil, err
 		}
 
-		rule, err := NewMapfileRule(&MapfileRuleConfig{
-			StartRegExp: mapfileStartRegExp,
-			EndRegExp:   mapfileEndRegExp,
-			DefaultSkip: cfg.Mapfile.DefaultSkip,
-			EmbedRules:  embedRules,
+		fileRules = append(fileRules, &FileRules{
+			Match: func(filePath string) bool {
+				return ft.match(cfg.baseDir, filePath)
+			},
+			Rules: rules,
+		})
+	}
+
+	procCfg := &ProcessorConfig{
+		Rules:     rules,
+		FileRules: fileRules,
+		// the directory of the config file is the project root if root is not specified.
+		RootDir: cfg.resolvePath(cfg.Root),
+	}
+	for _, dir := range cfg.IncludePaths {
+		procCfg.IncludePaths = append(procCfg.IncludePaths, cfg.resolvePath(dir))
+	}
+
+	if cfg.CacheDir != "" {
+		resolver, err := NewGitResolver(&GitResolverConfig{
+			CacheDir: cfg.resolvePath(cfg.CacheDir),
 		})
 		if err != nil {
 			return nil, err
 		}
+		procCfg.SourceResolver = resolver
+	}
+
+	// allowedDirs enables the sandbox too. the root is the directory of the config file if root is not specified.
+	if cfg.Root != "" || len(cfg.AllowedDirs) != 0 {
+		sandbox := &Sandbox{
+			RootDir: cfg.resolvePath(cfg.Root),
+		}
+		for _, dir := range cfg.AllowedDirs {
+			sandbox.AllowedDirs = append(sandbox.AllowedDirs, cfg.resolvePath(dir))
+		}
+		procCfg.Sandbox = sandbox
+	}
+
+	return procCfg, nil
+}
+
+func buildRules(mapfile *MapfileDirective, maprange *MaprangeDirective, mapsymbol *MapsymbolDirective, directives []*CustomDirective) ([]Rule, error) {
+	var rules []Rule
+	for _, d := range []interface{ toRule() (Rule, error) }{mapfile, maprange, mapsymbol} {
+		rule, err := d.toRule()
+		if err != nil {
+			return nil, err
+		}
 
 		rules = append(rules, rule)
 	}
 
-	{
-		var maprangeStartRegExp *regexp.Regexp
-		if v := cfg.Maprange.StartRegExp; v != "" {
-			maprangeStartRegExp, err = regexp.Compile(v)
-			if err != nil {
-				return nil, fmt.Errorf("maprange.startRegExp compile failed: %w", err)
-			}
+	for _, d := range directives {
+		rule, err := d.toRule()
+		if err != nil {
+			return nil, err
 		}
-		var maprangeEndRegExp *regexp.Regexp
-		if v := cfg.Maprange.EndRegExp; v != "" {
-			maprangeEndRegExp, err = regexp.Compile(v)
-			if err != nil {
-				return nil, fmt.Errorf("mapfile.endRegExp compile failed: %w", err)
-			}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func (d *MapfileDirective) toRule() (_ Rule, err error) {
+	var mapfileStartRegExp *regexp.Regexp
+	if v := d.StartRegExp; v != "" {
+		mapfileStartRegExp, err = regexp.Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("mapfile.startRegExp compile failed: %w", err)
 		}
+	}
+	var mapfileEndRegExp *regexp.Regexp
+	if v := d.EndRegExp; v != "" {
+		mapfileEndRegExp, err = regexp.Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("mapfile.endRegExp compile failed: %w", err)
+		}
+	}
 
-		var embedRules []Rule
-		if !cfg.Maprange.DisableDedent {
-			rule, err := NewDedentRule(&DedentRuleConfig{
-				SpaceRegExp: nil,
-			})
-			if err != nil {
-				return nil, err
-			}
+	var embedRules []Rule
+	if !d.DisableRewriteIndent {
+		rule, err := NewReindentRule(&ReindentRuleConfig{
+			IndentLevel: d.IndentWidth,
+		})
+		if err != nil {
+			return nil, err
+		}
 
-			embedRules = append(embedRules, rule)
+		embedRules = append(embedRules, rule)
+	}
+
+	rule, err := NewMapfileRule(&MapfileRuleConfig{
+		StartRegExp: mapfileStartRegExp,
+		EndRegExp:   mapfileEndRegExp,
+		DefaultSkip: d.DefaultSkip,
+		EmbedRules:  embedRules,
+		Recursive:   d.Recursive,
+		MaxDepth:    d.MaxDepth,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+func (d *MaprangeDirective) toRule() (_ Rule, err error) {
+	var maprangeStartRegExp *regexp.Regexp
+	if v := d.StartRegExp; v != "" {
+		maprangeStartRegExp, err = regexp.Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("maprange.startRegExp compile failed: %w", err)
 		}
-		if !cfg.Maprange.DisableRewriteIndent {
-			rule, err := NewReindentRule(&ReindentRuleConfig{
-				IndentLevel: cfg.Maprange.IndentWidth,
-			})
-			if err != nil {
-				return nil, err
-			}
+	}
+	var maprangeEndRegExp *regexp.Regexp
+	if v := d.EndRegExp; v != "" {
+		maprangeEndRegExp, err = regexp.Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("mapfile.endRegExp compile failed: %w", err)
+		}
+	}
 
-			embedRules = append(embedRules, rule)
+	var embedRules []Rule
+	if !d.DisableDedent {
+		rule, err := NewDedentRule(&DedentRuleConfig{
+			SpaceRegExp: nil,
+		})
+		if err != nil {
+			return nil, err
 		}
 
-		rule, err := NewMaprangeRule(&MaprangeRuleConfig{
-			StartRegExp: maprangeStartRegExp,
-			EndRegExp:   maprangeEndRegExp,
-			DefaultSkip: cfg.Maprange.DefaultSkip,
-			EmbedRules:  embedRules,
+		embedRules = append(embedRules, rule)
+	}
+	if !d.DisableRewriteIndent {
+		rule, err := NewReindentRule(&ReindentRuleConfig{
+			IndentLevel: d.IndentWidth,
 		})
 		if err != nil {
 			return nil, err
 		}
 
-		rules = append(rules, rule)
+		embedRules = append(embedRules, rule)
 	}
 
-	procCfg := &ProcessorConfig{
-		Rules: rules,
+	rule, err := NewMaprangeRule(&MaprangeRuleConfig{
+		StartRegExp: maprangeStartRegExp,
+		EndRegExp:   maprangeEndRegExp,
+		DefaultSkip: d.DefaultSkip,
+		EmbedRules:  embedRules,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return procCfg, nil
+	return rule, nil
+}
+
+func (d *MapsymbolDirective) toRule() (_ Rule, err error) {
+	var mapsymbolStartRegExp *regexp.Regexp
+	if v := d.StartRegExp; v != "" {
+		mapsymbolStartRegExp, err = regexp.Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("mapsymbol.startRegExp compile failed: %w", err)
+		}
+	}
+	var mapsymbolEndRegExp *regexp.Regexp
+	if v := d.EndRegExp; v != "" {
+		mapsymbolEndRegExp, err = regexp.Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("mapsymbol.endRegExp compile failed: %w", err)
+		}
+	}
+
+	var embedRules []Rule
+	if !d.DisableDedent {
+		rule, err := NewDedentRule(&DedentRuleConfig{
+			SpaceRegExp: nil,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		embedRules = append(embedRules, rule)
+	}
+	if !d.DisableRewriteIndent {
+		rule, err := NewReindentRule(&ReindentRuleConfig{
+			IndentLevel: d.IndentWidth,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		embedRules = append(embedRules, rule)
+	}
+
+	rule, err := NewMapsymbolRule(&MapsymbolRuleConfig{
+		StartRegExp: mapsymbolStartRegExp,
+		EndRegExp:   mapsymbolEndRegExp,
+		DefaultSkip: d.DefaultSkip,
+		EmbedRules:  embedRules,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+func (d *CustomDirective) toRule() (Rule, error) {
+	startRegExp, err := regexp.Compile(d.StartRegExp)
+	if err != nil {
+		return nil, fmt.Errorf("%s.startRegExp compile failed: %w", d.Name, err)
+	}
+	endRegExp, err := regexp.Compile(d.EndRegExp)
+	if err != nil {
+		return nil, fmt.Errorf("%s.endRegExp compile failed: %w", d.Name, err)
+	}
+
+	var embedRules []Rule
+	for _, step := range d.PostProcess {
+		var rule Rule
+		switch step.Type {
+		case "dedent":
+			rule, err = NewDedentRule(&DedentRuleConfig{
+				SpaceRegExp: nil,
+			})
+		case "reindent":
+			rule, err = NewReindentRule(&ReindentRuleConfig{
+				IndentLevel: step.IndentWidth,
+			})
+		default:
+			return nil, fmt.Errorf("%s directive has unknown post process: %s", d.Name, step.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		embedRules = append(embedRules, rule)
+	}
+
+	switch d.Kind {
+	case "file", "lines":
+		return NewMapfileRule(&MapfileRuleConfig{
+			Name:           d.Name,
+			StartRegExp:    startRegExp,
+			EndRegExp:      endRegExp,
+			DefaultSkip:    d.DefaultSkip,
+			EmbedRules:     embedRules,
+			LinesShorthand: d.Kind == "lines",
+		})
+	case "range":
+		return NewMaprangeRule(&MaprangeRuleConfig{
+			Name:        d.Name,
+			StartRegExp: startRegExp,
+			EndRegExp:   endRegExp,
+			DefaultSkip: d.DefaultSkip,
+			EmbedRules:  embedRules,
+		})
+	case "symbol":
+		return NewMapsymbolRule(&MapsymbolRuleConfig{
+			Name:        d.Name,
+			StartRegExp: startRegExp,
+			EndRegExp:   endRegExp,
+			DefaultSkip: d.DefaultSkip,
+			EmbedRules:  embedRules,
+		})
+	default:
+		return nil, fmt.Errorf("%s directive has unknown kind: %s", d.Name, d.Kind)
+	}
+}
+
+func (d *CustomDirective) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", d.Name),
+		slog.String("kind", d.Kind),
+		slog.String("startRegExp", d.StartRegExp),
+		slog.String("endRegExp", d.EndRegExp),
+		slog.Int("defaultSkip", d.DefaultSkip),
+		slog.Int("postProcess", len(d.PostProcess)),
+	)
+}
+
+func (ft *FileType) match(baseDir string, filePath string) bool {
+	for _, pattern := range ft.Patterns {
+		if strings.HasPrefix(pattern, ".") && !strings.ContainsAny(pattern, "*?[/") {
+			if filepath.Ext(filePath) == pattern {
+				return true
+			}
+			continue
+		}
+
+		target := filepath.Base(filePath)
+		if strings.Contains(pattern, "/") {
+			absBaseDir, err := filepath.Abs(baseDir)
+			if err != nil {
+				continue
+			}
+			absFilePath, err := filepath.Abs(filePath)
+			if err != nil {
+				continue
+			}
+			relPath, err := filepath.Rel(absBaseDir, absFilePath)
+			if err != nil {
+				continue
+			}
+			target = filepath.ToSlash(relPath)
+		}
+
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolvePath resolves relative path from the directory of the config file.
+func (cfg *Config) resolvePath(filePath string) string {
+	if filepath.IsAbs(filePath) {
+		return filePath
+	}
+	return filepath.Join(cfg.baseDir, filePath)
 }
 
 func (d *MapfileDirective) LogValue() slog.Value {
@@ -251,6 +814,8 @@ func (d *MapfileDirective) LogValue() slog.Value {
 		slog.Bool("disableRewriteIndent", d.DisableRewriteIndent),
 		slog.Int("indentWidth", d.IndentWidth),
 		slog.Int("defaultSkip", d.DefaultSkip),
+		slog.Bool("recursive", d.Recursive),
+		slog.Int("maxDepth", d.MaxDepth),
 	)
 }
 
@@ -264,3 +829,14 @@ func (d *MaprangeDirective) LogValue() slog.Value {
 		slog.Int("defaultSkip", d.DefaultSkip),
 	)
 }
+
+func (d *MapsymbolDirective) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("startRegExp", d.StartRegExp),
+		slog.String("endRegExp", d.EndRegExp),
+		slog.Bool("disableDedent", d.DisableDedent),
+		slog.Bool("disableRewriteIndent", d.DisableRewriteIndent),
+		slog.Int("indentWidth", d.IndentWidth),
+		slog.Int("defaultSkip", d.DefaultSkip),
+	)
+}
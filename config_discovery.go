@@ -0,0 +1,212 @@
+package ptproc
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"go.opentelemetry.io/otel"
+)
+
+// ConfigFileNames are names of config files found by FindConfigFiles.
+// if a directory has both, the former is used.
+var ConfigFileNames = []string{"ptproc.yaml", "ptproc.cue"}
+
+// FindConfigFiles returns config files in the directory of filePath and its ancestors up to rootDir.
+// if rootDir is empty, it walks up to the directory which has .git or the file system root.
+// the farthest file comes first.
+func FindConfigFiles(filePath string, rootDir string) ([]string, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if rootDir != "" {
+		rootDir, err = filepath.Abs(rootDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var configFiles []string
+	for dir := filepath.Dir(absPath); ; {
+		for _, name := range ConfigFileNames {
+			configFile := filepath.Join(dir, name)
+			if _, err := os.Stat(configFile); err == nil {
+				configFiles = append(configFiles, configFile)
+				break
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+		}
+
+		if dir == rootDir {
+			break
+		}
+		if rootDir == "" {
+			if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+				break
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	slices.Reverse(configFiles)
+
+	return configFiles, nil
+}
+
+// LoadConfigs loads config files and merges them key by key. latter files override former ones.
+// relative paths in each file are resolved from the directory of the file.
+// the directory of the first file is the project root if root is not specified.
+// returns the default config if filePaths is empty.
+func LoadConfigs(ctx context.Context, filePaths []string) (_ *Config, err error) {
+	ctx, span := otel.Tracer("ptproc").Start(ctx, "LoadConfigs")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	if len(filePaths) == 0 {
+		cfg := &Config{}
+		err = cfg.fillByDefault()
+		if err != nil {
+			return nil, err
+		}
+		return cfg, nil
+	}
+	if len(filePaths) == 1 {
+		return LoadConfig(ctx, filePaths[0])
+	}
+
+	baseDir, err := filepath.Abs(filepath.Dir(filePaths[0]))
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]any)
+	for _, filePath := range filePaths {
+		b, err := readConfigFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		var m map[string]any
+		err = yaml.UnmarshalContext(ctx, b, &m)
+		if err != nil {
+			return nil, err
+		}
+
+		dir, err := filepath.Abs(filepath.Dir(filePath))
+		if err != nil {
+			return nil, err
+		}
+		err = resolveConfigPaths(m, baseDir, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		mergeConfigMap(merged, m)
+	}
+
+	b, err := yaml.MarshalContext(ctx, merged)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{
+		baseDir: baseDir,
+	}
+	err = yaml.UnmarshalContext(ctx, b, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.fillByDefault()
+	if err != nil {
+		return nil, err
+	}
+
+	slog.DebugContext(ctx, "config files loaded", slog.Any("filePaths", filePaths), "config", cfg)
+
+	return cfg, nil
+}
+
+// resolveConfigPaths rewrites relative paths in m to absolute paths from dir,
+// and patterns of fileTypes to be relative to baseDir.
+func resolveConfigPaths(m map[string]any, baseDir string, dir string) error {
+	resolve := func(v any) any {
+		s, ok := v.(string)
+		if !ok || s == "" || filepath.IsAbs(s) {
+			return v
+		}
+		return filepath.Join(dir, s)
+	}
+
+	for _, key := range []string{"root", "cacheDir"} {
+		if v, ok := m[key]; ok {
+			m[key] = resolve(v)
+		}
+	}
+	for _, key := range []string{"allowedDirs", "includePaths"} {
+		if vs, ok := m[key].([]any); ok {
+			for idx, v := range vs {
+				vs[idx] = resolve(v)
+			}
+		}
+	}
+
+	relDir, err := filepath.Rel(baseDir, dir)
+	if err != nil {
+		return err
+	}
+	if relDir == "." {
+		return nil
+	}
+	fileTypes, _ := m["fileTypes"].([]any)
+	for _, ft := range fileTypes {
+		ft, ok := ft.(map[string]any)
+		if !ok {
+			continue
+		}
+		patterns, _ := ft["patterns"].([]any)
+		for idx, pattern := range patterns {
+			s, ok := pattern.(string)
+			if !ok || !strings.Contains(s, "/") {
+				continue
+			}
+			patterns[idx] = filepath.ToSlash(relDir) + "/" + s
+		}
+	}
+
+	return nil
+}
+
+// mergeConfigMap merges src into dst recursively. values other than maps are overridden by src.
+func mergeConfigMap(dst map[string]any, src map[string]any) {
+	for key, v := range src {
+		srcMap, ok := v.(map[string]any)
+		if !ok {
+			dst[key] = v
+			continue
+		}
+		dstMap, ok := dst[key].(map[string]any)
+		if !ok {
+			dstMap = make(map[string]any)
+			dst[key] = dstMap
+		}
+		mergeConfigMap(dstMap, srcMap)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/goccy/go-yaml"
 	"github.com/vvakame/ptproc/internal/testutils"
 )
@@ -74,3 +77,319 @@ func Test_LoadConfig(t *testing.T) {
 		})
 	}
 }
+
+func Test_Config_FileTypes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	baseDir := t.TempDir()
+
+	files := map[string]string{
+		"ptproc.yaml": heredoc.Doc(`
+			mapfile:
+			  disableRewriteIndent: true
+			fileTypes:
+			  - patterns: [".md"]
+			    mapfile:
+			      startRegExp: "^<!--\\s*mapfile:(.+?)\\s*-->\\s*$"
+			      endRegExp: "^<!--\\s*mapfile.end\\s*-->\\s*$"
+			      disableRewriteIndent: true
+			  - patterns: ["*.re", "docs/*.txt"]
+			    mapfile:
+			      startRegExp: "^#@mapfile\\((.+)\\)\\s*$"
+			      endRegExp: "^#@end\\s*$"
+			      disableRewriteIndent: true
+		`),
+		"external.txt": "external\n",
+		"test.md": heredoc.Doc(`
+			<!-- mapfile:external.txt -->
+			<!-- mapfile.end -->
+			#@mapfile(external.txt)
+			#@end
+		`),
+		"test.re": heredoc.Doc(`
+			<!-- mapfile:external.txt -->
+			<!-- mapfile.end -->
+			#@mapfile(external.txt)
+			#@end
+		`),
+		"docs/test.txt": heredoc.Doc(`
+			#@mapfile(../external.txt)
+			#@end
+		`),
+		"test.txt": heredoc.Doc(`
+			mapfile:external.txt
+			mapfile.end
+		`),
+	}
+	for name, s := range files {
+		filePath := filepath.Join(baseDir, name)
+		err := os.MkdirAll(filepath.Dir(filePath), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filePath, []byte(s), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := LoadConfig(ctx, filepath.Join(baseDir, "ptproc.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	procCfg, err := cfg.ToProcessorConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc, err := NewProcessor(procCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{
+			file: "test.md",
+			want: heredoc.Doc(`
+				<!-- mapfile:external.txt -->
+				external
+				<!-- mapfile.end -->
+				#@mapfile(external.txt)
+				#@end
+			`),
+		},
+		{
+			file: "test.re",
+			want: heredoc.Doc(`
+				<!-- mapfile:external.txt -->
+				<!-- mapfile.end -->
+				#@mapfile(external.txt)
+				external
+				#@end
+			`),
+		},
+		{
+			file: "docs/test.txt",
+			want: heredoc.Doc(`
+				#@mapfile(../external.txt)
+				external
+				#@end
+			`),
+		},
+		{
+			file: "test.txt",
+			want: heredoc.Doc(`
+				mapfile:external.txt
+				external
+				mapfile.end
+			`),
+		},
+	}
+	for _, tt := range tests {
+		s, err := proc.ProcessFile(ctx, filepath.Join(baseDir, tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != tt.want {
+			t.Errorf("%s: got = %v, want %v", tt.file, s, tt.want)
+		}
+	}
+}
+
+func Test_LoadConfigs(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	baseDir := t.TempDir()
+
+	files := map[string]string{
+		"ptproc.yaml": heredoc.Doc(`
+			includePaths:
+			  - snippets
+			mapfile:
+			  indentWidth: 4
+			  defaultSkip: 1
+		`),
+		"sub/ptproc.yaml": heredoc.Doc(`
+			mapfile:
+			  indentWidth: 8
+			maprange:
+			  disableDedent: true
+		`),
+		"sub/docs/test.md": "",
+	}
+	for name, s := range files {
+		filePath := filepath.Join(baseDir, name)
+		err := os.MkdirAll(filepath.Dir(filePath), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filePath, []byte(s), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configFiles, err := FindConfigFiles(filepath.Join(baseDir, "sub/docs/test.md"), baseDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFiles := []string{
+		filepath.Join(baseDir, "ptproc.yaml"),
+		filepath.Join(baseDir, "sub/ptproc.yaml"),
+	}
+	if !reflect.DeepEqual(configFiles, expectedFiles) {
+		t.Fatalf("unexpected config files: %v", configFiles)
+	}
+
+	cfg, err := LoadConfigs(ctx, configFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := cfg.Mapfile.IndentWidth; v != 8 {
+		t.Errorf("unexpected mapfile.indentWidth: %d", v)
+	}
+	if v := cfg.Mapfile.DefaultSkip; v != 1 {
+		t.Errorf("unexpected mapfile.defaultSkip: %d", v)
+	}
+	if v := cfg.Maprange.DisableDedent; !v {
+		t.Errorf("unexpected maprange.disableDedent: %v", v)
+	}
+	if v := cfg.IncludePaths; !reflect.DeepEqual(v, []string{filepath.Join(baseDir, "snippets")}) {
+		t.Errorf("unexpected includePaths: %v", v)
+	}
+
+	procCfg, err := cfg.ToProcessorConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := procCfg.RootDir; v != baseDir {
+		t.Errorf("unexpected root dir: %s", v)
+	}
+}
+
+func Test_LoadConfig_Schema(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		fileName string
+		content  string
+		wantErr  string
+	}{
+		{
+			name:     "yaml",
+			fileName: "ptproc.yaml",
+			content: heredoc.Doc(`
+				mapfile:
+				  indentWidth: 4
+				directives:
+				  - name: review-mapfile
+				    kind: file
+				    startRegExp: "^#@mapfile\\((.+)\\)\\s*$"
+				    endRegExp: "^#@end\\s*$"
+			`),
+		},
+		{
+			name:     "yaml with null sections",
+			fileName: "ptproc.yaml",
+			content: heredoc.Doc(`
+				mapfile:
+				  indentWidth: 4
+				maprange:
+				  # disableDedent: true
+				fileTypes:
+				  - patterns: [".md"]
+				    mapfile:
+			`),
+		},
+		{
+			name:     "yaml with unknown field",
+			fileName: "ptproc.yaml",
+			content: heredoc.Doc(`
+				mapfile:
+				  indentWidth: 4
+				maprange:
+				  disableDedant: true
+			`),
+			wantErr: "ptproc.yaml:4:3: maprange.disableDedant: field not allowed",
+		},
+		{
+			name:     "yaml with unknown field in list",
+			fileName: "ptproc.yaml",
+			content: heredoc.Doc(`
+				directives:
+				  - name: review-mapfile
+				    kind: file
+				    startRegExp: "^#@mapfile\\((.+)\\)\\s*$"
+				    endRegExp: "^#@end\\s*$"
+				    postProces:
+				      - type: dedent
+			`),
+			wantErr: "ptproc.yaml:6:5: directives.0.postProces: field not allowed",
+		},
+		{
+			name:     "yaml with mismatched type",
+			fileName: "ptproc.yaml",
+			content: heredoc.Doc(`
+				mapfile:
+				  indentWidth: "4"
+			`),
+			wantErr: "ptproc.yaml:2:3: mapfile.indentWidth: conflicting values",
+		},
+		{
+			name:     "cue",
+			fileName: "ptproc.cue",
+			content: heredoc.Doc(`
+				mapfile: indentWidth: 4
+				maprange: disableDedent: true
+			`),
+		},
+		{
+			name:     "cue with unknown field",
+			fileName: "ptproc.cue",
+			content: heredoc.Doc(`
+				mapfile: indentWidth: 4
+				maprange: disableDedant: true
+			`),
+			wantErr: "ptproc.cue:2:11: maprange.disableDedant: field not allowed",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			filePath := filepath.Join(t.TempDir(), tt.fileName)
+			err := os.WriteFile(filePath, []byte(tt.content), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := LoadConfig(ctx, filePath)
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatal("error is expected")
+				}
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if v := cfg.Mapfile.IndentWidth; v != 4 {
+				t.Errorf("unexpected mapfile.indentWidth: %d", v)
+			}
+		})
+	}
+}
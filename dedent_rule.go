@@ -58,12 +58,12 @@ func (rule *dedentRule) Apply(ctx context.Context, opts *RuleOptions, ns []Node)
 	}
 	space := group[1]
 
-	newNodes = append(newNodes, &node{strings.TrimPrefix(txt, space)})
+	newNodes = append(newNodes, &node{text: strings.TrimPrefix(txt, space), line: h.Line(), column: h.Column()})
 
 	for _, n := range ns[1:] {
 		txt := n.Text()
 
-		newNodes = append(newNodes, &node{strings.TrimPrefix(txt, space)})
+		newNodes = append(newNodes, &node{text: strings.TrimPrefix(txt, space), line: n.Line(), column: n.Column()})
 	}
 
 	return newNodes, nil
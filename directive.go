@@ -0,0 +1,97 @@
+package ptproc
+
+import (
+	"fmt"
+	"regexp"
+)
+
+type blockNode interface {
+	Node
+	block() *Block
+}
+
+// matchDirective matches re against the line node n.
+// returned Block has the start directive information, arg is the first submatch of re.
+func matchDirective(re *regexp.Regexp, n Node) (_ *Block, arg string, ok bool) {
+	if _, isLine := n.(*node); !isLine {
+		return nil, "", false
+	}
+
+	txt := n.Text()
+	loc := re.FindStringSubmatchIndex(txt)
+	if loc == nil {
+		return nil, "", false
+	}
+	if len(loc) >= 4 && loc[2] >= 0 {
+		arg = txt[loc[2]:loc[3]]
+	}
+
+	b := &Block{
+		Start:       n,
+		Directive:   txt[loc[0]:loc[1]],
+		StartLine:   n.Line(),
+		StartColumn: n.Column() + loc[0],
+	}
+
+	return b, arg, true
+}
+
+// matchBlocks groups lines between startRegExp and endRegExp matched lines into block nodes.
+// newBlock receives the first submatch of startRegExp. blocks are owned by owner.
+// if newBlock returns nested true, directives of the same kind in the block are counted as nested blocks and kept in the body.
+// it is for recursive embedding, the content of other blocks may contain directive-like lines without end directives.
+// returned errors are wrapped by DirectiveError with filePath.
+func matchBlocks(owner Rule, kind string, filePath string, ns []Node, startRegExp, endRegExp *regexp.Regexp, newBlock func(arg string) (bn blockNode, nested bool, err error)) ([]Node, error) {
+	newNodes := make([]Node, 0, len(ns))
+
+	var current blockNode
+	var nested bool
+	var depth int
+	for _, n := range ns {
+		if current == nil {
+			start, arg, ok := matchDirective(startRegExp, n)
+			if !ok || startRegExp.NumSubexp() != 1 {
+				newNodes = append(newNodes, n)
+				continue
+			}
+			start.Kind = kind
+
+			bn, isNested, err := newBlock(arg)
+			if err != nil {
+				return nil, start.wrapError(filePath, err)
+			}
+
+			b := bn.block()
+			*b = *start
+			b.owner = owner
+			current = bn
+			nested = isNested
+			depth = 0
+		} else {
+			b := current.block()
+
+			_, _, isStart := matchDirective(startRegExp, n)
+			_, _, isEnd := matchDirective(endRegExp, n)
+			switch {
+			case isStart && nested:
+				depth++
+			case isEnd && depth != 0:
+				depth--
+			case isEnd:
+				b.End = n
+				b.EndLine = n.Line()
+				newNodes = append(newNodes, current)
+				current = nil
+				continue
+			}
+
+			b.Body = append(b.Body, n)
+		}
+	}
+
+	if current != nil {
+		return nil, current.block().wrapError(filePath, fmt.Errorf("%s end directive is not found", kind))
+	}
+
+	return newNodes, nil
+}
@@ -0,0 +1,31 @@
+package ptproc
+
+import (
+	"fmt"
+)
+
+var _ error = (*DirectiveError)(nil)
+
+// DirectiveError is an error which occurred while processing a directive.
+// use errors.As to retrieve it from the error returned by Processor.
+type DirectiveError struct {
+	// FilePath is the path of the file which contains the directive.
+	FilePath string
+	// Line is the 1-origin line number of the start directive.
+	Line int
+	// Column is the 1-origin column number of the start directive.
+	Column int
+	// Directive is the text of the start directive.
+	Directive string
+	// Kind is the name of the directive. e.g. "mapfile" or the name of a custom directive.
+	Kind string
+	Err  error
+}
+
+func (e *DirectiveError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %v", e.FilePath, e.Line, e.Column, e.Directive, e.Err)
+}
+
+func (e *DirectiveError) Unwrap() error {
+	return e.Err
+}
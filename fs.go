@@ -0,0 +1,96 @@
+package ptproc
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+var _ fs.ReadFileFS = osFS{}
+var _ fs.StatFS = osFS{}
+var _ fs.ReadDirFS = osFS{}
+var _ fs.ReadFileFS = openFileFS(nil)
+
+// OSFS returns a read-only fs.FS for the local file system.
+// unlike os.DirFS, it accepts OS native paths including absolute paths and "..".
+func OSFS() fs.FS {
+	return osFS{}
+}
+
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+func (osFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (osFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+// openFileFS adapts ProcessorConfig.OpenFile to fs.FS.
+type openFileFS func(filePath string) (io.Reader, error)
+
+func (f openFileFS) Open(name string) (fs.File, error) {
+	r, err := f(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &readerFile{name: name, r: r}, nil
+}
+
+func (f openFileFS) ReadFile(name string) (_ []byte, err error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		cerr := file.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+
+	return io.ReadAll(file)
+}
+
+type readerFile struct {
+	name string
+	r    io.Reader
+}
+
+func (f *readerFile) Stat() (fs.FileInfo, error) {
+	return readerFileInfo{name: f.name}, nil
+}
+
+func (f *readerFile) Read(b []byte) (int, error) {
+	return f.r.Read(b)
+}
+
+func (f *readerFile) Close() error {
+	if rc, ok := f.r.(io.Closer); ok {
+		return rc.Close()
+	}
+	return nil
+}
+
+// readerFileInfo is fs.FileInfo of readerFile. the size is unknown.
+type readerFileInfo struct {
+	name string
+}
+
+func (fi readerFileInfo) Name() string       { return fi.name }
+func (fi readerFileInfo) Size() int64        { return 0 }
+func (fi readerFileInfo) Mode() fs.FileMode  { return 0o444 }
+func (fi readerFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi readerFileInfo) IsDir() bool        { return false }
+func (fi readerFileInfo) Sys() any           { return nil }
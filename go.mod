@@ -5,6 +5,7 @@ go 1.25.0
 require (
 	cuelang.org/go v0.17.1
 	github.com/MakeNowJust/heredoc/v2 v2.0.1
+	github.com/fsnotify/fsnotify v1.10.1
 	github.com/goccy/go-yaml v1.13.6
 	github.com/pmezard/go-difflib v1.0.0
 	github.com/urfave/cli/v2 v2.27.7
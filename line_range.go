@@ -0,0 +1,105 @@
+package ptproc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultEllipsis is inserted between selected line ranges.
+const DefaultEllipsis = "..."
+
+type lineRange struct {
+	// start and end are 1-origin and inclusive. 0 means the first or last line.
+	start int
+	end   int
+}
+
+func (lr lineRange) String() string {
+	var start, end string
+	if lr.start != 0 {
+		start = strconv.Itoa(lr.start)
+	}
+	if lr.end != 0 {
+		end = strconv.Itoa(lr.end)
+	}
+	if start == end {
+		return start
+	}
+	return start + "-" + end
+}
+
+// parseLineRanges parses line range specs like "10-25", "10-", "-25", "10" or "1-3,10-12".
+func parseLineRanges(s string) ([]lineRange, error) {
+	var lrs []lineRange
+	for _, spec := range strings.Split(s, ",") {
+		spec = strings.TrimSpace(spec)
+
+		startStr, endStr, found := strings.Cut(spec, "-")
+		if !found {
+			endStr = startStr
+		}
+
+		var lr lineRange
+		if v := strings.TrimSpace(startStr); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid line range: %s", spec)
+			}
+			lr.start = n
+		}
+		if v := strings.TrimSpace(endStr); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid line range: %s", spec)
+			}
+			lr.end = n
+		}
+		if !found && lr.start == 0 {
+			return nil, fmt.Errorf("invalid line range: %s", spec)
+		}
+		if lr.start != 0 && lr.end != 0 && lr.start > lr.end {
+			return nil, fmt.Errorf("invalid line range: %s", spec)
+		}
+
+		lrs = append(lrs, lr)
+	}
+
+	return lrs, nil
+}
+
+// selectLines returns lines of s in lrs. ranges are joined by ellipsis line.
+func selectLines(s string, lrs []lineRange, ellipsis string) (string, error) {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var buf strings.Builder
+	for idx, lr := range lrs {
+		start := lr.start
+		if start == 0 {
+			start = 1
+		}
+		end := lr.end
+		if end == 0 {
+			end = len(lines)
+		}
+		if start > len(lines) || end > len(lines) {
+			return "", fmt.Errorf("line range %s is out of file. the file has %d lines", lr, len(lines))
+		}
+
+		if idx != 0 {
+			buf.WriteString(ellipsis)
+			buf.WriteString("\n")
+		}
+		for _, line := range lines[start-1 : end] {
+			buf.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				buf.WriteString("\n")
+			}
+		}
+	}
+
+	return buf.String(), nil
+}
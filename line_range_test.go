@@ -0,0 +1,78 @@
+package ptproc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseLineRanges(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		input   string
+		output  []lineRange
+		wantErr bool
+	}{
+		{
+			name:   "range",
+			input:  "10-25",
+			output: []lineRange{{start: 10, end: 25}},
+		},
+		{
+			name:   "single line",
+			input:  "10",
+			output: []lineRange{{start: 10, end: 10}},
+		},
+		{
+			name:   "open start",
+			input:  "-25",
+			output: []lineRange{{start: 0, end: 25}},
+		},
+		{
+			name:   "open end",
+			input:  "10-",
+			output: []lineRange{{start: 10, end: 0}},
+		},
+		{
+			name:   "multiple",
+			input:  "1-3, 10-12",
+			output: []lineRange{{start: 1, end: 3}, {start: 10, end: 12}},
+		},
+		{
+			name:    "reversed",
+			input:   "25-10",
+			wantErr: true,
+		},
+		{
+			name:    "zero",
+			input:   "0-10",
+			wantErr: true,
+		},
+		{
+			name:    "not a number",
+			input:   "a-b",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			input:   "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			output, err := parseLineRanges(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(output, tt.output) {
+				t.Errorf("got = %v, want %v", output, tt.output)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package ptproc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+
+	"go.opentelemetry.io/otel"
+)
+
+// Lint checks directives in target documents and range markers in source files.
+// source files are files referred by directives in documents and sourcePaths.
+// it reports directives which refer to missing files or ranges,
+// duplicate range names, unbalanced range markers and ranges which no document refers to.
+func Lint(ctx context.Context, proc Processor, filePaths []string, sourcePaths []string) (_ []*Diagnostic, err error) {
+	ctx, span := otel.Tracer("ptproc").Start(ctx, "Lint")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	var diags []*Diagnostic
+	var sources []string
+	// referred range names by source file.
+	referred := make(map[string][]string)
+	definedRanges := make(map[string][]*lintRange)
+
+	for _, filePath := range filePaths {
+		opts := proc.RuleOptions(filePath)
+
+		b, err := fs.ReadFile(opts.FS, filePath)
+		if err != nil {
+			return nil, err
+		}
+		ns, err := proc.Parse(ctx, filePath, bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, n := range ns {
+			var file, rev string
+			var rangeParams *MaprangeParams
+			switch n := n.(type) {
+			case *MapFileNode:
+				file, rev = n.Params.File, n.Params.Rev
+			case *MapRangeNode:
+				file, rev, rangeParams = n.Params.File, n.Params.Rev, n.Params
+			case *MapSymbolNode:
+				file = n.Params.File
+			default:
+				continue
+			}
+			if rev != "" {
+				// the file at the revision is not on the file system.
+				continue
+			}
+
+			sourcePath, err := opts.ResolvePath(file)
+			if err != nil {
+				diags = append(diags, &Diagnostic{FilePath: filePath, Line: n.Line(), Message: err.Error()})
+				continue
+			}
+			sourcePath = filepath.Clean(sourcePath)
+			if _, err := fs.Stat(opts.FS, sourcePath); err != nil {
+				diags = append(diags, &Diagnostic{FilePath: filePath, Line: n.Line(), Message: fmt.Sprintf("file %s is not found", file)})
+				continue
+			}
+
+			if !slices.Contains(sources, sourcePath) {
+				sources = append(sources, sourcePath)
+			}
+			if rangeParams == nil {
+				continue
+			}
+
+			referred[sourcePath] = append(referred[sourcePath], rangeParams.Name)
+
+			ranges, ok := definedRanges[sourcePath]
+			if !ok {
+				ranges, _, err = lintRanges(ctx, proc, sourcePath)
+				if err != nil {
+					return nil, err
+				}
+				definedRanges[sourcePath] = ranges
+			}
+			if !slices.ContainsFunc(ranges, func(r *lintRange) bool { return r.name == rangeParams.Name }) && !rangeParams.AllowMissing {
+				diags = append(diags, &Diagnostic{FilePath: filePath, Line: n.Line(), Message: fmt.Sprintf("range %q is not found in %s", rangeParams.Name, file)})
+			}
+		}
+	}
+
+	for _, sourcePath := range sourcePaths {
+		sourcePath = filepath.Clean(sourcePath)
+		if !slices.Contains(sources, sourcePath) {
+			sources = append(sources, sourcePath)
+		}
+	}
+
+	for _, sourcePath := range sources {
+		ranges, rangeDiags, err := lintRanges(ctx, proc, sourcePath)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range ranges {
+			if slices.Contains(referred[sourcePath], r.name) {
+				continue
+			}
+			rangeDiags = append(rangeDiags, &Diagnostic{FilePath: sourcePath, Line: r.line, Message: fmt.Sprintf("range %q is not referred by any document", r.name)})
+		}
+		slices.SortStableFunc(rangeDiags, func(a, b *Diagnostic) int { return a.Line - b.Line })
+		diags = append(diags, rangeDiags...)
+	}
+
+	return diags, nil
+}
+
+type lintRange struct {
+	name string
+	line int
+}
+
+// lintRanges returns ranges defined in the file and problems of range markers.
+// duplicate ranges are returned only once.
+func lintRanges(ctx context.Context, proc Processor, filePath string) ([]*lintRange, []*Diagnostic, error) {
+	opts := proc.RuleOptions(filePath)
+
+	b, err := fs.ReadFile(opts.FS, filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// parse lines only. directives of the file itself are not processed.
+	lineProc, err := proc.WithRules(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	ns, err := lineProc.Parse(ctx, filePath, bytes.NewReader(b))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rule := &rangeImportRule{}
+
+	var diags []*Diagnostic
+	markers, err := rule.rangeMarkers(ctx, opts, ns, func(b *Block, err error) error {
+		diags = append(diags, &Diagnostic{FilePath: filePath, Line: b.StartLine, Message: err.Error()})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	pairRangeMarkers(markers)
+
+	var ranges []*lintRange
+	for _, m := range markers {
+		switch {
+		case m.end && m.pair == nil:
+			message := "range end directive doesn't have start directive"
+			if name := m.name(); name != "" {
+				message = fmt.Sprintf("range end directive of %q doesn't have start directive", name)
+			}
+			diags = append(diags, &Diagnostic{FilePath: filePath, Line: m.block.StartLine, Message: message})
+
+		case m.end:
+			continue
+
+		case m.pair == nil:
+			// the start marker is treated as text by maprange.
+			diags = append(diags, &Diagnostic{FilePath: filePath, Line: m.block.StartLine, Message: fmt.Sprintf("range %q is not closed", m.name())})
+
+		default:
+			r := &lintRange{name: m.name(), line: m.block.StartLine}
+			idx := slices.IndexFunc(ranges, func(v *lintRange) bool { return v.name == r.name })
+			if idx != -1 {
+				diags = append(diags, &Diagnostic{FilePath: filePath, Line: r.line, Message: fmt.Sprintf("range %q is already defined at line %d", r.name, ranges[idx].line)})
+			} else {
+				ranges = append(ranges, r)
+			}
+		}
+	}
+
+	return ranges, diags, nil
+}
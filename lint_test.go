@@ -0,0 +1,85 @@
+package ptproc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/MakeNowJust/heredoc/v2"
+)
+
+func Test_Lint(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	fsys := fstest.MapFS{
+		"docs/test.md": &fstest.MapFile{
+			Data: []byte(heredoc.Doc(`
+				<!-- mapfile:../src/notfound.txt -->
+				<!-- mapfile.end -->
+				<!-- maprange:../src/external.txt,a -->
+				<!-- maprange.end -->
+				<!-- maprange:../src/external.txt,notfound -->
+				<!-- maprange.end -->
+				<!-- maprange:file:"../src/external.txt",name:"optional",allowMissing:true -->
+				<!-- maprange.end -->
+			`)),
+			Mode: 0o444,
+		},
+		"src/external.txt": &fstest.MapFile{
+			Data: []byte(heredoc.Doc(`
+				// range:a
+				a
+				// range.end
+				// range:unused
+				// range.end
+				// range:a
+				// range.end
+				// range.end
+				// range:open
+			`)),
+			Mode: 0o444,
+		},
+		"src/other.txt": &fstest.MapFile{
+			Data: []byte(heredoc.Doc(`
+				// range.end:b
+			`)),
+			Mode: 0o444,
+		},
+	}
+
+	proc, err := NewProcessor(&ProcessorConfig{
+		FS: fsys,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diags, err := Lint(ctx, proc, []string{"docs/test.md"}, []string{"src/other.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.String())
+	}
+
+	expected := []string{
+		`docs/test.md:1: file ../src/notfound.txt is not found`,
+		`docs/test.md:5: range "notfound" is not found in ../src/external.txt`,
+		`src/external.txt:4: range "unused" is not referred by any document`,
+		`src/external.txt:6: range "a" is already defined at line 1`,
+		`src/external.txt:8: range end directive doesn't have start directive`,
+		`src/external.txt:9: range "open" is not closed`,
+		`src/other.txt:1: range end directive of "b" doesn't have start directive`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		for _, s := range got {
+			t.Log(s)
+		}
+		t.Errorf("unexpected diagnostics")
+	}
+}
@@ -3,25 +3,37 @@ package ptproc
 import (
 	"context"
 	"errors"
-	"io"
+	"fmt"
 	"log/slog"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 
-	"cuelang.org/go/cue/cuecontext"
 	"go.opentelemetry.io/otel"
 )
 
 var _ Rule = (*mapfileRule)(nil)
+var _ DirectiveParser = (*mapfileRule)(nil)
 
 var DefaultMapfileStartRegEx = regexp.MustCompile(`mapfile:([^\s]+)`)
 var DefaultMapfileEndRegEx = regexp.MustCompile(`mapfile.end`)
 
+const DefaultMaxDepth = 10
+
 type MapfileRuleConfig struct {
+	// Name is the directive name used in error messages. "mapfile" is used if empty.
+	Name        string
 	StartRegExp *regexp.Regexp
 	EndRegExp   *regexp.Regexp
 	DefaultSkip int
 	EmbedRules  []Rule
+	// Recursive makes embedded content processed by all rules of the processor before EmbedRules.
+	Recursive bool
+	// MaxDepth limits nesting of recursive embedding. DefaultMaxDepth is used if 0.
+	MaxDepth int
+	// LinesShorthand makes the short form of the directive "file,lines". e.g. `main.go,10-25`.
+	LinesShorthand bool
 }
 
 func NewMapfileRule(cfg *MapfileRuleConfig) (Rule, error) {
@@ -29,36 +41,115 @@ func NewMapfileRule(cfg *MapfileRuleConfig) (Rule, error) {
 		cfg = &MapfileRuleConfig{}
 	}
 
+	name := cfg.Name
+	if name == "" {
+		name = "mapfile"
+	}
+
 	return &mapfileRule{
+		name:        name,
 		startRegExp: cfg.StartRegExp,
 		endRegExp:   cfg.EndRegExp,
 		defaultSkip: cfg.DefaultSkip,
 		embedRules:  cfg.EmbedRules,
+		recursive:   cfg.Recursive,
+		maxDepth:    cfg.MaxDepth,
+
+		linesShorthand: cfg.LinesShorthand,
 	}, nil
 }
 
 type mapfileRule struct {
+	name        string
 	startRegExp *regexp.Regexp
 	endRegExp   *regexp.Regexp
 	defaultSkip int
+	recursive   bool
+	maxDepth    int
+
+	linesShorthand bool
 
 	embedRules []Rule
 }
 
-type mapfileParams struct {
-	File string `cue:"file"`
-	Skip *int   `cue:"skip"`
+type MapfileParams struct {
+	File      string `cue:"file"`
+	Skip      *int   `cue:"skip"`
+	Recursive *bool  `cue:"recursive"`
+	// Rev is the revision of the file. e.g. "v1.2.0". the file is read by SourceResolver if specified.
+	Rev string `cue:"rev"`
+	// Lines selects lines of the file. e.g. "10-25", "10-", "-25" or "1-3,10-12".
+	Lines string `cue:"lines"`
+	// Start and End select lines of the file. 1-origin and inclusive.
+	Start *int `cue:"start"`
+	End   *int `cue:"end"`
+	// Ellipsis is inserted between line ranges. DefaultEllipsis is used if nil.
+	Ellipsis *string `cue:"ellipsis"`
+	// From and To are regexps to select lines of the file.
+	// From must match exactly one line, To matches the first line after From.
+	From        string `cue:"from"`
+	To          string `cue:"to"`
+	ExcludeFrom bool   `cue:"excludeFrom"`
+	ExcludeTo   bool   `cue:"excludeTo"`
 }
 
-func (rule *mapfileRule) Apply(ctx context.Context, opts *RuleOptions, ns []Node) (_ []Node, err error) {
-	ctx, span := otel.Tracer("ptproc").Start(ctx, "mapfileRule.Apply")
-	defer func() {
+func (params *MapfileParams) lineRanges() ([]lineRange, error) {
+	if params.Lines != "" && (params.Start != nil || params.End != nil) {
+		return nil, errors.New("lines and start/end can't be specified at the same time")
+	}
+
+	if params.Lines != "" {
+		return parseLineRanges(params.Lines)
+	}
+	if params.Start == nil && params.End == nil {
+		return nil, nil
+	}
+
+	var lr lineRange
+	if params.Start != nil {
+		lr.start = *params.Start
+	}
+	if params.End != nil {
+		lr.end = *params.End
+	}
+	if lr.start < 0 || lr.end < 0 || (lr.start != 0 && lr.end != 0 && lr.start > lr.end) {
+		return nil, fmt.Errorf("invalid line range: start=%d, end=%d", lr.start, lr.end)
+	}
+
+	return []lineRange{lr}, nil
+}
+
+func (params *MapfileParams) anchorRange() (*anchorRange, error) {
+	if params.From == "" && params.To == "" {
+		return nil, nil
+	}
+	if params.Lines != "" || params.Start != nil || params.End != nil {
+		return nil, errors.New("from/to and lines or start/end can't be specified at the same time")
+	}
+
+	ar := &anchorRange{
+		excludeFrom: params.ExcludeFrom,
+		excludeTo:   params.ExcludeTo,
+	}
+	if params.From != "" {
+		re, err := regexp.Compile(params.From)
 		if err != nil {
-			span.RecordError(err)
+			return nil, fmt.Errorf("from regexp compile failed: %w", err)
 		}
-		span.End()
-	}()
+		ar.from = re
+	}
+	if params.To != "" {
+		re, err := regexp.Compile(params.To)
+		if err != nil {
+			return nil, fmt.Errorf("to regexp compile failed: %w", err)
+		}
+		ar.to = re
+	}
+
+	return ar, nil
+}
 
+func (rule *mapfileRule) ParseDirectives(ctx context.Context, opts *RuleOptions, ns []Node) (_ []Node, err error) {
 	startRegExp := rule.startRegExp
 	if startRegExp == nil {
 		startRegExp = DefaultMapfileStartRegEx
@@ -68,98 +159,170 @@ func (rule *mapfileRule) Apply(ctx context.Context, opts *RuleOptions, ns []Node
 		endRegExp = DefaultMapfileEndRegEx
 	}
 
-	slog.DebugContext(ctx, "start mapfile rule processing")
+	ns, err = matchBlocks(rule, rule.name, opts.TargetPath, ns, startRegExp, endRegExp, func(arg string) (blockNode, bool, error) {
+		params, err := rule.textToParams(ctx, opts, arg)
+		if err != nil {
+			return nil, false, err
+		}
 
-	newNodes := make([]Node, 0, len(ns))
+		// content of recursive embedding contains directives.
+		recursive := rule.recursive
+		if params.Recursive != nil {
+			recursive = *params.Recursive
+		}
 
-	var inMapfileRange bool
-	var realFilePath string
-	var skip int
-	var skipped int
-	var skipBuffer []Node
-	for _, n := range ns {
-		txt := n.Text()
+		return &MapFileNode{ImportFile: params.File, Params: params}, recursive, nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		if !inMapfileRange {
-			group := startRegExp.FindStringSubmatch(txt)
+	for _, n := range ns {
+		mapfileNode, ok := n.(*MapFileNode)
+		if !ok {
+			continue
+		}
+		if _, ok := mapfileNode.End.(*MapFileEndNode); !ok {
+			mapfileNode.End = &MapFileEndNode{Node: mapfileNode.End}
+		}
+	}
 
-			if len(group) != 2 {
-				newNodes = append(newNodes, n)
-				continue
-			}
+	return ns, nil
+}
 
-			params, err := rule.textToParams(ctx, group[1])
-			if err != nil {
-				return nil, err
-			}
+func (rule *mapfileRule) Apply(ctx context.Context, opts *RuleOptions, ns []Node) (_ []Node, err error) {
+	ctx, span := otel.Tracer("ptproc").Start(ctx, "mapfileRule.Apply")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
 
-			filePath := params.File
-			realFilePath = opts.FilePath(filePath)
-			skip = rule.defaultSkip
-			if params.Skip != nil {
-				skip = *params.Skip
-			}
-			skipped = 0
-			slog.DebugContext(ctx, "find mapfile directive",
-				slog.String("filePath", filePath),
-				slog.String("realFilePath", realFilePath),
-				slog.Int("skip", skip),
-			)
-
-			inMapfileRange = true
-			newNodes = append(newNodes, n)
-		} else if endRegExp.MatchString(txt) {
-			inMapfileRange = false
-			head := len(skipBuffer) - skip
-			if head < 0 {
-				head = 0
-			}
+	slog.DebugContext(ctx, "start mapfile rule processing")
 
-			s, err := rule.loadEmbed(ctx, opts, realFilePath)
-			if err != nil {
-				return nil, err
-			}
+	ns, err = rule.ParseDirectives(ctx, opts, ns)
+	if err != nil {
+		return nil, err
+	}
 
-			newNodes = append(newNodes, &node{
-				text: s,
-			})
+	newNodes := make([]Node, 0, len(ns))
 
-			newNodes = append(newNodes, skipBuffer[head:]...)
-			newNodes = append(newNodes, n)
-			skipBuffer = nil
-		} else if skipped < skip {
+	for _, n := range ns {
+		mapfileNode, ok := n.(*MapFileNode)
+		if !ok || mapfileNode.owner != rule {
 			newNodes = append(newNodes, n)
-			skipped++
-		} else {
-			skipBuffer = append(skipBuffer, n)
+			continue
 		}
-	}
 
-	if inMapfileRange {
-		return nil, errors.New("mapfile end directive is not found")
+		params := mapfileNode.Params
+		filePath := params.File
+		realFilePath, err := opts.ResolvePath(filePath)
+		if err != nil {
+			return nil, mapfileNode.wrapError(opts.TargetPath, err)
+		}
+		skip := rule.defaultSkip
+		if params.Skip != nil {
+			skip = *params.Skip
+		}
+		recursive := rule.recursive
+		if params.Recursive != nil {
+			recursive = *params.Recursive
+		}
+		slog.DebugContext(ctx, "find mapfile directive",
+			slog.String("filePath", filePath),
+			slog.String("realFilePath", realFilePath),
+			slog.Int("skip", skip),
+			slog.Bool("recursive", recursive),
+			slog.Int("line", mapfileNode.StartLine),
+		)
+
+		s, err := rule.loadEmbed(ctx, opts, realFilePath, params, recursive)
+		if err != nil {
+			return nil, mapfileNode.wrapError(opts.TargetPath, err)
+		}
+
+		newNode := *mapfileNode
+		newNode.Body = mapfileNode.replaceContent(skip, []Node{&node{text: s}})
+		newNodes = append(newNodes, &newNode)
 	}
 
 	return newNodes, nil
 }
 
-func (rule *mapfileRule) loadEmbed(ctx context.Context, opts *RuleOptions, filePath string) (_ string, err error) {
-	r, err := opts.OpenFile(filePath)
+func (rule *mapfileRule) loadEmbed(ctx context.Context, opts *RuleOptions, filePath string, params *MapfileParams, recursive bool) (_ string, err error) {
+	lrs, err := params.lineRanges()
 	if err != nil {
 		return "", err
 	}
-	b, err := io.ReadAll(r)
+	ar, err := params.anchorRange()
+	if err != nil {
+		return "", err
+	}
+
+	b, err := opts.ReadFile(ctx, filePath, params.Rev)
 	if err != nil {
 		return "", err
 	}
 	s := string(b)
 
+	if len(lrs) != 0 {
+		ellipsis := DefaultEllipsis
+		if params.Ellipsis != nil {
+			ellipsis = *params.Ellipsis
+		}
+		s, err = selectLines(s, lrs, ellipsis)
+		if err != nil {
+			return "", err
+		}
+	}
+	if ar != nil {
+		s, err = ar.selectLines(s)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if recursive {
+		// the same file can be reached by different paths. e.g. "docs/a.md" and "@root/docs/a.md".
+		chain := includeChainFromContext(ctx)
+		if len(chain) == 0 {
+			targetPath, err := filepath.Abs(opts.TargetPath)
+			if err != nil {
+				return "", err
+			}
+			chain = []string{targetPath}
+		}
+		absPath, err := filepath.Abs(filePath)
+		if err != nil {
+			return "", err
+		}
+		chain = append(slices.Clip(chain), absPath)
+
+		if slices.Contains(chain[:len(chain)-1], chain[len(chain)-1]) {
+			return "", fmt.Errorf("include cycle detected: %s", strings.Join(chain, " -> "))
+		}
+		maxDepth := rule.maxDepth
+		if maxDepth == 0 {
+			maxDepth = DefaultMaxDepth
+		}
+		if len(chain)-1 > maxDepth {
+			return "", fmt.Errorf("max include depth %d exceeded: %s", maxDepth, strings.Join(chain, " -> "))
+		}
+
+		s, err = opts.Processor.Process(contextWithIncludeChain(ctx, chain), filePath, strings.NewReader(s))
+		if err != nil {
+			return "", err
+		}
+	}
+
 	if len(rule.embedRules) != 0 {
 		subProc, err := opts.Processor.WithRules(ctx, rule.embedRules)
 		if err != nil {
 			return "", err
 		}
 
-		s, err = subProc.ProcessFile(ctx, filePath)
+		s, err = subProc.Process(ctx, filePath, strings.NewReader(s))
 		if err != nil {
 			return "", err
 		}
@@ -172,29 +335,42 @@ func (rule *mapfileRule) loadEmbed(ctx context.Context, opts *RuleOptions, fileP
 	return s, nil
 }
 
-func (rule *mapfileRule) textToParams(ctx context.Context, s string) (*mapfileParams, error) {
-	cuectx := cuecontext.New()
-
-	cv := cuectx.CompileString(s)
-
-	err := cv.Validate()
+func (rule *mapfileRule) textToParams(ctx context.Context, opts *RuleOptions, s string) (*MapfileParams, error) {
+	v, params, err := parseParams[MapfileParams](ctx, opts.paramParser(), "MapfileParams", s)
 	if err != nil {
-		slog.DebugContext(ctx, "cue validate failed. evaluate to string", "err", err, "value", s)
-		return &mapfileParams{File: s}, nil
+		return nil, err
 	}
+	if params == nil {
+		return rule.shorthandToParams(v)
+	}
+
+	return params, nil
+}
 
-	v, err := cv.String()
-	if err == nil {
-		return &mapfileParams{File: v}, nil
-	} else {
-		slog.DebugContext(ctx, "failed to convert cue value to string. continue processing", "err", err, "value", s)
+func (rule *mapfileRule) shorthandToParams(s string) (*MapfileParams, error) {
+	if !rule.linesShorthand {
+		return &MapfileParams{File: s}, nil
 	}
 
-	params := &mapfileParams{}
-	err = cv.Decode(params)
-	if err != nil {
-		return nil, err
+	ss := strings.SplitN(s, ",", 2)
+	if len(ss) != 2 {
+		return nil, fmt.Errorf("unexpected %s syntax: %s", rule.name, s)
 	}
 
-	return params, nil
+	return &MapfileParams{
+		File:  ss[0],
+		Lines: ss[1],
+	}, nil
+}
+
+type includeChainKey struct{}
+
+// includeChainFromContext returns absolute file paths of recursive embedding. the first one is the root document.
+func includeChainFromContext(ctx context.Context) []string {
+	chain, _ := ctx.Value(includeChainKey{}).([]string)
+	return chain
+}
+
+func contextWithIncludeChain(ctx context.Context, chain []string) context.Context {
+	return context.WithValue(ctx, includeChainKey{}, chain)
 }
@@ -7,7 +7,9 @@ import (
 	"os"
 	"reflect"
 	"regexp"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/MakeNowJust/heredoc/v2"
 )
@@ -19,6 +21,8 @@ func Test_mapfileRule_Apply(t *testing.T) {
 		name          string
 		startRegExp   *regexp.Regexp
 		endRegExp     *regexp.Regexp
+		recursive     bool
+		maxDepth      int
 		externalFile  func(t *testing.T, filePath string) string
 		inputFileName string
 		input         string
@@ -169,6 +173,423 @@ func Test_mapfileRule_Apply(t *testing.T) {
 			`),
 			wantErr: false,
 		},
+		{
+			name:      "recursive",
+			recursive: true,
+			externalFile: func(t *testing.T, filePath string) string {
+				switch filePath {
+				case "external1.txt":
+					return heredoc.Doc(`
+						external1.txt content
+						mapfile:external2.txt
+						mapfile.end
+					`)
+				case "external2.txt":
+					return "external2.txt content"
+				default:
+					t.Fatalf("unexpected external file: %s", filePath)
+					return ""
+				}
+			},
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapfile:external1.txt
+				external1.txt content
+				mapfile:external2.txt
+				old content
+				mapfile.end
+				mapfile.end
+			`),
+			output: heredoc.Doc(`
+				mapfile:external1.txt
+				external1.txt content
+				mapfile:external2.txt
+				external2.txt content
+				mapfile.end
+				mapfile.end
+			`),
+			wantErr: false,
+		},
+		{
+			name: "recursive by cue",
+			externalFile: func(t *testing.T, filePath string) string {
+				switch filePath {
+				case "external1.txt":
+					return heredoc.Doc(`
+						mapfile:external2.txt
+						mapfile.end
+					`)
+				case "external2.txt":
+					return "external2.txt content"
+				default:
+					t.Fatalf("unexpected external file: %s", filePath)
+					return ""
+				}
+			},
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapfile:file:"external1.txt",recursive:true
+				mapfile.end
+			`),
+			output: heredoc.Doc(`
+				mapfile:file:"external1.txt",recursive:true
+				mapfile:external2.txt
+				external2.txt content
+				mapfile.end
+				mapfile.end
+			`),
+			wantErr: false,
+		},
+		{
+			name:      "recursive cycle",
+			recursive: true,
+			externalFile: func(t *testing.T, filePath string) string {
+				switch filePath {
+				case "external.txt":
+					return heredoc.Doc(`
+						mapfile:test.txt
+						mapfile.end
+					`)
+				default:
+					t.Fatalf("unexpected external file: %s", filePath)
+					return ""
+				}
+			},
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapfile:external.txt
+				mapfile.end
+			`),
+			wantErr: true,
+		},
+		{
+			name:      "recursive max depth",
+			recursive: true,
+			maxDepth:  1,
+			externalFile: func(t *testing.T, filePath string) string {
+				switch filePath {
+				case "external1.txt":
+					return heredoc.Doc(`
+						mapfile:external2.txt
+						mapfile.end
+					`)
+				case "external2.txt":
+					return "external2.txt content"
+				default:
+					t.Fatalf("unexpected external file: %s", filePath)
+					return ""
+				}
+			},
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapfile:external1.txt
+				mapfile.end
+			`),
+			wantErr: true,
+		},
+		{
+			name: "no newline at end of file",
+			externalFile: func(t *testing.T, filePath string) string {
+				switch filePath {
+				case "external.txt":
+					return "external.txt content"
+				default:
+					t.Fatalf("unexpected external file: %s", filePath)
+					return ""
+				}
+			},
+			inputFileName: "test.txt",
+			input:         "mapfile:external.txt\nmapfile.end",
+			output:        "mapfile:external.txt\nexternal.txt content\nmapfile.end",
+			wantErr:       false,
+		},
+		{
+			name: "lines",
+			externalFile: func(t *testing.T, filePath string) string {
+				switch filePath {
+				case "external.txt":
+					return heredoc.Doc(`
+						line1
+						line2
+						line3
+						line4
+						line5
+					`)
+				default:
+					t.Fatalf("unexpected external file: %s", filePath)
+					return ""
+				}
+			},
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapfile:file:"external.txt",lines:"2-3"
+				mapfile.end
+			`),
+			output: heredoc.Doc(`
+				mapfile:file:"external.txt",lines:"2-3"
+				line2
+				line3
+				mapfile.end
+			`),
+			wantErr: false,
+		},
+		{
+			name: "start and end",
+			externalFile: func(t *testing.T, filePath string) string {
+				switch filePath {
+				case "external.txt":
+					return heredoc.Doc(`
+						line1
+						line2
+						line3
+						line4
+						line5
+					`)
+				default:
+					t.Fatalf("unexpected external file: %s", filePath)
+					return ""
+				}
+			},
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapfile:file:"external.txt",start:4
+				mapfile.end
+			`),
+			output: heredoc.Doc(`
+				mapfile:file:"external.txt",start:4
+				line4
+				line5
+				mapfile.end
+			`),
+			wantErr: false,
+		},
+		{
+			name: "multiple lines",
+			externalFile: func(t *testing.T, filePath string) string {
+				switch filePath {
+				case "external.txt":
+					return heredoc.Doc(`
+						line1
+						line2
+						line3
+						line4
+						line5
+					`)
+				default:
+					t.Fatalf("unexpected external file: %s", filePath)
+					return ""
+				}
+			},
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapfile:file:"external.txt",lines:"1,3-4",ellipsis:"//snip"
+				mapfile.end
+			`),
+			output: heredoc.Doc(`
+				mapfile:file:"external.txt",lines:"1,3-4",ellipsis:"//snip"
+				line1
+				//snip
+				line3
+				line4
+				mapfile.end
+			`),
+			wantErr: false,
+		},
+		{
+			name: "lines out of file",
+			externalFile: func(t *testing.T, filePath string) string {
+				switch filePath {
+				case "external.txt":
+					return heredoc.Doc(`
+						line1
+						line2
+						line3
+						line4
+						line5
+					`)
+				default:
+					t.Fatalf("unexpected external file: %s", filePath)
+					return ""
+				}
+			},
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapfile:file:"external.txt",lines:"4-6"
+				mapfile.end
+			`),
+			wantErr: true,
+		},
+		{
+			name: "anchors",
+			externalFile: func(t *testing.T, filePath string) string {
+				switch filePath {
+				case "external.go":
+					return heredoc.Doc(`
+						package main
+
+						func Parse() {
+							parse()
+						}
+
+						func Format() {
+							format()
+						}
+					`)
+				default:
+					t.Fatalf("unexpected external file: %s", filePath)
+					return ""
+				}
+			},
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapfile:file:"external.go",from:"^func\\sFormat",to:"^}"
+				mapfile.end
+			`),
+			output: heredoc.Doc(`
+				mapfile:file:"external.go",from:"^func\\sFormat",to:"^}"
+				func Format() {
+					format()
+				}
+				mapfile.end
+			`),
+			wantErr: false,
+		},
+		{
+			name: "anchors exclusive",
+			externalFile: func(t *testing.T, filePath string) string {
+				switch filePath {
+				case "external.go":
+					return heredoc.Doc(`
+						package main
+
+						func Parse() {
+							parse()
+						}
+
+						func Format() {
+							format()
+						}
+					`)
+				default:
+					t.Fatalf("unexpected external file: %s", filePath)
+					return ""
+				}
+			},
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapfile:file:"external.go",from:"^func\\sParse",to:"^}",excludeFrom:true,excludeTo:true
+				mapfile.end
+			`),
+			output: heredoc.Doc(`
+				mapfile:file:"external.go",from:"^func\\sParse",to:"^}",excludeFrom:true,excludeTo:true
+					parse()
+				mapfile.end
+			`),
+			wantErr: false,
+		},
+		{
+			name: "from anchor only",
+			externalFile: func(t *testing.T, filePath string) string {
+				switch filePath {
+				case "external.go":
+					return heredoc.Doc(`
+						package main
+
+						func Parse() {
+							parse()
+						}
+
+						func Format() {
+							format()
+						}
+					`)
+				default:
+					t.Fatalf("unexpected external file: %s", filePath)
+					return ""
+				}
+			},
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapfile:file:"external.go",from:"^func\\sFormat"
+				mapfile.end
+			`),
+			output: heredoc.Doc(`
+				mapfile:file:"external.go",from:"^func\\sFormat"
+				func Format() {
+					format()
+				}
+				mapfile.end
+			`),
+			wantErr: false,
+		},
+		{
+			name: "anchor matches nothing",
+			externalFile: func(t *testing.T, filePath string) string {
+				switch filePath {
+				case "external.go":
+					return heredoc.Doc(`
+						package main
+
+						func Parse() {
+							parse()
+						}
+
+						func Format() {
+							format()
+						}
+					`)
+				default:
+					t.Fatalf("unexpected external file: %s", filePath)
+					return ""
+				}
+			},
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapfile:file:"external.go",from:"^func\\sPrint",to:"^}"
+				mapfile.end
+			`),
+			wantErr: true,
+		},
+		{
+			name: "anchor matches more than once",
+			externalFile: func(t *testing.T, filePath string) string {
+				switch filePath {
+				case "external.go":
+					return heredoc.Doc(`
+						package main
+
+						func Parse() {
+							parse()
+						}
+
+						func Format() {
+							format()
+						}
+					`)
+				default:
+					t.Fatalf("unexpected external file: %s", filePath)
+					return ""
+				}
+			},
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapfile:file:"external.go",from:"^func",to:"^}"
+				mapfile.end
+			`),
+			wantErr: true,
+		},
+		{
+			name: "unknown param",
+			externalFile: func(t *testing.T, filePath string) string {
+				return "external.txt content"
+			},
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapfile:file:"external.txt",skp:1
+				mapfile.end
+			`),
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		tt := tt
@@ -180,6 +601,8 @@ func Test_mapfileRule_Apply(t *testing.T) {
 			rule, err := NewMapfileRule(&MapfileRuleConfig{
 				StartRegExp: tt.startRegExp,
 				EndRegExp:   tt.endRegExp,
+				Recursive:   tt.recursive,
+				MaxDepth:    tt.maxDepth,
 			})
 			if err != nil {
 				t.Fatal(err)
@@ -215,3 +638,74 @@ func Test_mapfileRule_Apply(t *testing.T) {
 		})
 	}
 }
+
+func Test_mapfileRule_Apply_idempotent(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		recursive bool
+		external  string
+	}{
+		{
+			name:     "directive-like line in embedded content",
+			external: "see mapfile:foo.txt here\n",
+		},
+		{
+			name:      "recursive",
+			recursive: true,
+			external: heredoc.Doc(`
+				<!-- mapfile:foo.txt -->
+				<!-- mapfile.end -->
+			`),
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			input := heredoc.Doc(`
+				<!-- mapfile:ext.txt -->
+				<!-- mapfile.end -->
+			`)
+			fsys := fstest.MapFS{
+				"doc.md":  &fstest.MapFile{Data: []byte(input)},
+				"ext.txt": &fstest.MapFile{Data: []byte(tt.external)},
+				"foo.txt": &fstest.MapFile{Data: []byte("foo\n")},
+			}
+
+			rule, err := NewMapfileRule(&MapfileRuleConfig{
+				Recursive: tt.recursive,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			proc, err := NewProcessor(&ProcessorConfig{
+				FS:    fsys,
+				Rules: []Rule{rule},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output, err := proc.ProcessFile(ctx, "doc.md")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// processing the output again must not change it. --check and --watch rely on it.
+			output2, err := proc.Process(ctx, "doc.md", strings.NewReader(output))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if output2 != output {
+				t.Errorf("got = %v, want %v", output2, output)
+			}
+		})
+	}
+}
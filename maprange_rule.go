@@ -1,24 +1,25 @@
 package ptproc
 
 import (
+	"bytes"
 	"context"
-	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"regexp"
 	"strings"
 
-	"cuelang.org/go/cue/cuecontext"
 	"go.opentelemetry.io/otel"
 )
 
 var _ Rule = (*maprangeRule)(nil)
+var _ DirectiveParser = (*maprangeRule)(nil)
 
 var DefaultMaprangeStartRegEx = regexp.MustCompile(`maprange:([^\s]+)`)
 var DefaultMaprangeEndRegEx = regexp.MustCompile(`maprange.end`)
 
 type MaprangeRuleConfig struct {
+	// Name is the directive name used in error messages. "maprange" is used if empty.
+	Name        string
 	StartRegExp *regexp.Regexp
 	EndRegExp   *regexp.Regexp
 	DefaultSkip int
@@ -30,7 +31,13 @@ func NewMaprangeRule(cfg *MaprangeRuleConfig) (Rule, error) {
 		cfg = &MaprangeRuleConfig{}
 	}
 
+	name := cfg.Name
+	if name == "" {
+		name = "maprange"
+	}
+
 	return &maprangeRule{
+		name:        name,
 		startRegExp: cfg.StartRegExp,
 		endRegExp:   cfg.EndRegExp,
 		defaultSkip: cfg.DefaultSkip,
@@ -39,6 +46,7 @@ func NewMaprangeRule(cfg *MaprangeRuleConfig) (Rule, error) {
 }
 
 type maprangeRule struct {
+	name        string
 	startRegExp *regexp.Regexp
 	endRegExp   *regexp.Regexp
 	defaultSkip int
@@ -46,21 +54,16 @@ type maprangeRule struct {
 	embedRules []Rule
 }
 
-type maprangeParams struct {
-	File string `cue:"file"`
-	Name string `cue:"name"`
-	Skip *int   `cue:"skip"`
+type MaprangeParams struct {
+	File         string `cue:"file"`
+	Name         string `cue:"name"`
+	Skip         *int   `cue:"skip"`
+	AllowMissing bool   `cue:"allowMissing"`
+	// Rev is the revision of the file. e.g. "v1.2.0". the file is read by SourceResolver if specified.
+	Rev string `cue:"rev"`
 }
 
-func (rule *maprangeRule) Apply(ctx context.Context, opts *RuleOptions, ns []Node) (_ []Node, err error) {
-	ctx, span := otel.Tracer("ptproc").Start(ctx, "maprangeRule.Apply")
-	defer func() {
-		if err != nil {
-			span.RecordError(err)
-		}
-		span.End()
-	}()
-
+func (rule *maprangeRule) ParseDirectives(ctx context.Context, opts *RuleOptions, ns []Node) (_ []Node, err error) {
 	startRegExp := rule.startRegExp
 	if startRegExp == nil {
 		startRegExp = DefaultMaprangeStartRegEx
@@ -70,96 +73,82 @@ func (rule *maprangeRule) Apply(ctx context.Context, opts *RuleOptions, ns []Nod
 		endRegExp = DefaultMaprangeEndRegEx
 	}
 
+	return matchBlocks(rule, rule.name, opts.TargetPath, ns, startRegExp, endRegExp, func(arg string) (blockNode, bool, error) {
+		params, err := rule.textToParams(ctx, opts, arg)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return &MapRangeNode{Params: params}, false, nil
+	})
+}
+
+func (rule *maprangeRule) Apply(ctx context.Context, opts *RuleOptions, ns []Node) (_ []Node, err error) {
+	ctx, span := otel.Tracer("ptproc").Start(ctx, "maprangeRule.Apply")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
 	slog.DebugContext(ctx, "start maprange rule processing")
 
+	ns, err = rule.ParseDirectives(ctx, opts, ns)
+	if err != nil {
+		return nil, err
+	}
+
 	newNodes := make([]Node, 0, len(ns))
 
-	var inMaprangeRange bool
-	var realFilePath string
-	var rangeName string
-	var skip int
-	var skipped int
-	var skipBuffer []Node
 	for _, n := range ns {
-		txt := n.Text()
-
-		if !inMaprangeRange {
-			group := startRegExp.FindStringSubmatch(txt)
-
-			if len(group) != 2 {
-				newNodes = append(newNodes, n)
-				continue
-			}
-
-			params, err := rule.textToParams(ctx, group[1])
-			if err != nil {
-				return nil, err
-			}
-
-			filePath := params.File
-			realFilePath = opts.FilePath(filePath)
-			rangeName = params.Name
-			skip = rule.defaultSkip
-			if params.Skip != nil {
-				skip = *params.Skip
-			}
-			skipped = 0
-			slog.DebugContext(ctx, "find maprange directive",
-				slog.String("filePath", filePath),
-				slog.String("realFilePath", realFilePath),
-				slog.String("rangeName", rangeName),
-				slog.Int("skip", skip),
-			)
-
-			inMaprangeRange = true
-			newNodes = append(newNodes, n)
-		} else if endRegExp.MatchString(txt) {
-			inMaprangeRange = false
-			head := len(skipBuffer) - skip
-			if head < 0 {
-				head = 0
-			}
-
-			s, err := rule.loadEmbed(ctx, opts, realFilePath, rangeName)
-			if err != nil {
-				return nil, err
-			}
-
-			newNodes = append(newNodes, &node{
-				text: s,
-			})
-
-			newNodes = append(newNodes, skipBuffer[head:]...)
-			newNodes = append(newNodes, n)
-			skipBuffer = nil
-		} else if skipped < skip {
+		maprangeNode, ok := n.(*MapRangeNode)
+		if !ok || maprangeNode.owner != rule {
 			newNodes = append(newNodes, n)
-			skipped++
-		} else {
-			skipBuffer = append(skipBuffer, n)
+			continue
+		}
+
+		params := maprangeNode.Params
+		filePath := params.File
+		realFilePath, err := opts.ResolvePath(filePath)
+		if err != nil {
+			return nil, maprangeNode.wrapError(opts.TargetPath, err)
+		}
+		rangeName := params.Name
+		skip := rule.defaultSkip
+		if params.Skip != nil {
+			skip = *params.Skip
+		}
+		slog.DebugContext(ctx, "find maprange directive",
+			slog.String("filePath", filePath),
+			slog.String("realFilePath", realFilePath),
+			slog.String("rangeName", rangeName),
+			slog.Int("skip", skip),
+			slog.Int("line", maprangeNode.StartLine),
+		)
+
+		s, err := rule.loadEmbed(ctx, opts, realFilePath, params)
+		if err != nil {
+			return nil, maprangeNode.wrapError(opts.TargetPath, err)
 		}
-	}
 
-	if inMaprangeRange {
-		return nil, errors.New("maprange end directive is not found")
+		newNode := *maprangeNode
+		newNode.Body = maprangeNode.replaceContent(skip, []Node{&node{text: s}})
+		newNodes = append(newNodes, &newNode)
 	}
 
 	return newNodes, nil
 }
 
-func (rule *maprangeRule) loadEmbed(ctx context.Context, opts *RuleOptions, filePath string, rangeName string) (_ string, err error) {
-	r, err := opts.OpenFile(filePath)
-	if err != nil {
-		return "", err
-	}
-	b, err := io.ReadAll(r)
+func (rule *maprangeRule) loadEmbed(ctx context.Context, opts *RuleOptions, filePath string, params *MaprangeParams) (_ string, err error) {
+	b, err := opts.ReadFile(ctx, filePath, params.Rev)
 	if err != nil {
 		return "", err
 	}
-	s := string(b)
 
 	rangeImportRule, err := NewRangeImportRule(&RangeImportRuleConfig{
-		Name: rangeName,
+		Name:         params.Name,
+		AllowMissing: params.AllowMissing,
 	})
 	if err != nil {
 		return "", err
@@ -172,7 +161,7 @@ func (rule *maprangeRule) loadEmbed(ctx context.Context, opts *RuleOptions, file
 		return "", err
 	}
 
-	s, err = subProc.ProcessFile(ctx, filePath)
+	s, err := subProc.Process(ctx, filePath, bytes.NewReader(b))
 	if err != nil {
 		return "", err
 	}
@@ -184,44 +173,21 @@ func (rule *maprangeRule) loadEmbed(ctx context.Context, opts *RuleOptions, file
 	return s, nil
 }
 
-func (rule *maprangeRule) textToParams(ctx context.Context, s string) (*maprangeParams, error) {
-	cuectx := cuecontext.New()
-
-	cv := cuectx.CompileString(s)
-
-	err := cv.Validate()
+func (rule *maprangeRule) textToParams(ctx context.Context, opts *RuleOptions, s string) (*MaprangeParams, error) {
+	v, params, err := parseParams[MaprangeParams](ctx, opts.paramParser(), "MaprangeParams", s)
 	if err != nil {
-		slog.DebugContext(ctx, "cue validate failed. evaluate to string", "err", err, "value", s)
-		ss := strings.SplitN(s, ",", 2)
-		if len(ss) != 2 {
-			return nil, fmt.Errorf("unexpected maprange syntax: %s", s)
-		}
-
-		return &maprangeParams{
-			File: ss[0],
-			Name: ss[1],
-		}, nil
+		return nil, err
 	}
-
-	v, err := cv.String()
-	if err == nil {
+	if params == nil {
 		ss := strings.SplitN(v, ",", 2)
 		if len(ss) != 2 {
-			return nil, fmt.Errorf("unexpected maprange syntax: %s", s)
+			return nil, fmt.Errorf("unexpected %s syntax: %s", rule.name, s)
 		}
 
-		return &maprangeParams{
+		return &MaprangeParams{
 			File: ss[0],
 			Name: ss[1],
 		}, nil
-	} else {
-		slog.DebugContext(ctx, "failed to convert cue value to string. continue processing", "err", err, "value", s)
-	}
-
-	params := &maprangeParams{}
-	err = cv.Decode(params)
-	if err != nil {
-		return nil, err
 	}
 
 	return params, nil
@@ -165,6 +165,75 @@ func Test_maprangeRule_Apply(t *testing.T) {
 			`),
 			wantErr: true,
 		},
+		{
+			name: "missing range",
+			externalFile: func(t *testing.T, filePath string) string {
+				switch filePath {
+				case "external.txt":
+					return heredoc.Doc(`
+						test1
+						range:name
+						test2
+						range.end
+						test3
+					`)
+				default:
+					t.Fatalf("unexpected external file: %s", filePath)
+					return ""
+				}
+			},
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				maprange:external.txt,typo
+				maprange.end
+			`),
+			wantErr: true,
+		},
+		{
+			name: "allow missing range",
+			externalFile: func(t *testing.T, filePath string) string {
+				switch filePath {
+				case "external.txt":
+					return heredoc.Doc(`
+						test1
+						range:name
+						test2
+						range.end
+						test3
+					`)
+				default:
+					t.Fatalf("unexpected external file: %s", filePath)
+					return ""
+				}
+			},
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				maprange:file:"external.txt",name:"typo",allowMissing:true
+				maprange.end
+			`),
+			output: heredoc.Doc(`
+				maprange:file:"external.txt",name:"typo",allowMissing:true
+
+				maprange.end
+			`),
+			wantErr: false,
+		},
+		{
+			name: "unknown param",
+			externalFile: func(t *testing.T, filePath string) string {
+				return heredoc.Doc(`
+					range:name
+					test
+					range.end
+				`)
+			},
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				maprange:file:"external.txt",name:"name",alowMissing:true
+				maprange.end
+			`),
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		tt := tt
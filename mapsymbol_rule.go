@@ -0,0 +1,282 @@
+package ptproc
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+)
+
+var _ Rule = (*mapsymbolRule)(nil)
+var _ DirectiveParser = (*mapsymbolRule)(nil)
+
+var DefaultMapsymbolStartRegEx = regexp.MustCompile(`mapsymbol:([^\s]+)`)
+var DefaultMapsymbolEndRegEx = regexp.MustCompile(`mapsymbol.end`)
+
+type MapsymbolRuleConfig struct {
+	// Name is the directive name used in error messages. "mapsymbol" is used if empty.
+	Name        string
+	StartRegExp *regexp.Regexp
+	EndRegExp   *regexp.Regexp
+	DefaultSkip int
+	EmbedRules  []Rule
+}
+
+func NewMapsymbolRule(cfg *MapsymbolRuleConfig) (Rule, error) {
+	if cfg == nil {
+		cfg = &MapsymbolRuleConfig{}
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name = "mapsymbol"
+	}
+
+	return &mapsymbolRule{
+		name:        name,
+		startRegExp: cfg.StartRegExp,
+		endRegExp:   cfg.EndRegExp,
+		defaultSkip: cfg.DefaultSkip,
+		embedRules:  cfg.EmbedRules,
+	}, nil
+}
+
+type mapsymbolRule struct {
+	name        string
+	startRegExp *regexp.Regexp
+	endRegExp   *regexp.Regexp
+	defaultSkip int
+
+	embedRules []Rule
+}
+
+type MapsymbolParams struct {
+	File string `cue:"file"`
+	// Symbol is the name of func, type, const or var declaration. methods are specified as "Type.Method".
+	Symbol string `cue:"symbol"`
+	Skip   *int   `cue:"skip"`
+	// Doc makes the doc comment of the declaration included.
+	Doc bool `cue:"doc"`
+}
+
+func (rule *mapsymbolRule) ParseDirectives(ctx context.Context, opts *RuleOptions, ns []Node) (_ []Node, err error) {
+	startRegExp := rule.startRegExp
+	if startRegExp == nil {
+		startRegExp = DefaultMapsymbolStartRegEx
+	}
+	endRegExp := rule.endRegExp
+	if endRegExp == nil {
+		endRegExp = DefaultMapsymbolEndRegEx
+	}
+
+	return matchBlocks(rule, rule.name, opts.TargetPath, ns, startRegExp, endRegExp, func(arg string) (blockNode, bool, error) {
+		params, err := rule.textToParams(ctx, opts, arg)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return &MapSymbolNode{Params: params}, false, nil
+	})
+}
+
+func (rule *mapsymbolRule) Apply(ctx context.Context, opts *RuleOptions, ns []Node) (_ []Node, err error) {
+	ctx, span := otel.Tracer("ptproc").Start(ctx, "mapsymbolRule.Apply")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	slog.DebugContext(ctx, "start mapsymbol rule processing")
+
+	ns, err = rule.ParseDirectives(ctx, opts, ns)
+	if err != nil {
+		return nil, err
+	}
+
+	newNodes := make([]Node, 0, len(ns))
+
+	for _, n := range ns {
+		mapsymbolNode, ok := n.(*MapSymbolNode)
+		if !ok || mapsymbolNode.owner != rule {
+			newNodes = append(newNodes, n)
+			continue
+		}
+
+		params := mapsymbolNode.Params
+		filePath := params.File
+		realFilePath, err := opts.ResolvePath(filePath)
+		if err != nil {
+			return nil, mapsymbolNode.wrapError(opts.TargetPath, err)
+		}
+		skip := rule.defaultSkip
+		if params.Skip != nil {
+			skip = *params.Skip
+		}
+		slog.DebugContext(ctx, "find mapsymbol directive",
+			slog.String("filePath", filePath),
+			slog.String("realFilePath", realFilePath),
+			slog.String("symbol", params.Symbol),
+			slog.Int("skip", skip),
+			slog.Int("line", mapsymbolNode.StartLine),
+		)
+
+		s, err := rule.loadEmbed(ctx, opts, realFilePath, params)
+		if err != nil {
+			return nil, mapsymbolNode.wrapError(opts.TargetPath, err)
+		}
+
+		newNode := *mapsymbolNode
+		newNode.Body = mapsymbolNode.replaceContent(skip, []Node{&node{text: s}})
+		newNodes = append(newNodes, &newNode)
+	}
+
+	return newNodes, nil
+}
+
+func (rule *mapsymbolRule) loadEmbed(ctx context.Context, opts *RuleOptions, filePath string, params *MapsymbolParams) (_ string, err error) {
+	b, err := opts.ReadFile(ctx, filePath, "")
+	if err != nil {
+		return "", err
+	}
+
+	s, err := findSymbol(filePath, b, params.Symbol, params.Doc)
+	if err != nil {
+		return "", err
+	}
+
+	if len(rule.embedRules) != 0 {
+		subProc, err := opts.Processor.WithRules(ctx, rule.embedRules)
+		if err != nil {
+			return "", err
+		}
+
+		s, err = subProc.Process(ctx, filePath, strings.NewReader(s))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+
+	return s, nil
+}
+
+// findSymbol returns the source lines of the declaration named symbol.
+func findSymbol(filePath string, src []byte, symbol string, withDoc bool) (string, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filePath, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return "", err
+	}
+
+	var target ast.Node
+	var doc *ast.CommentGroup
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			name := decl.Name.Name
+			if decl.Recv != nil && len(decl.Recv.List) != 0 {
+				name = receiverTypeName(decl.Recv.List[0].Type) + "." + name
+			}
+			if name == symbol {
+				target, doc = decl, decl.Doc
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				var names []*ast.Ident
+				var specDoc *ast.CommentGroup
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					names, specDoc = []*ast.Ident{spec.Name}, spec.Doc
+				case *ast.ValueSpec:
+					names, specDoc = spec.Names, spec.Doc
+				default:
+					continue
+				}
+				for _, name := range names {
+					if name.Name != symbol {
+						continue
+					}
+					if decl.Lparen.IsValid() {
+						// grouped declaration. embeds the spec only.
+						target, doc = spec, specDoc
+					} else {
+						target, doc = decl, decl.Doc
+					}
+				}
+			}
+		}
+		if target != nil {
+			break
+		}
+	}
+	if target == nil {
+		return "", fmt.Errorf("symbol %q is not found in %s", symbol, filePath)
+	}
+
+	start := fset.Position(target.Pos()).Offset
+	if withDoc && doc != nil {
+		start = fset.Position(doc.Pos()).Offset
+	}
+	end := fset.Position(target.End()).Offset
+
+	// expand to whole lines to keep indentation and trailing comment.
+	for start > 0 && src[start-1] != '\n' {
+		start--
+	}
+	for end < len(src) && src[end] != '\n' {
+		end++
+	}
+	if end < len(src) {
+		end++
+	}
+
+	return string(src[start:end]), nil
+}
+
+func receiverTypeName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return receiverTypeName(expr.X)
+	case *ast.IndexExpr:
+		return receiverTypeName(expr.X)
+	case *ast.IndexListExpr:
+		return receiverTypeName(expr.X)
+	case *ast.ParenExpr:
+		return receiverTypeName(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	default:
+		return ""
+	}
+}
+
+func (rule *mapsymbolRule) textToParams(ctx context.Context, opts *RuleOptions, s string) (*MapsymbolParams, error) {
+	v, params, err := parseParams[MapsymbolParams](ctx, opts.paramParser(), "MapsymbolParams", s)
+	if err != nil {
+		return nil, err
+	}
+	if params == nil {
+		ss := strings.SplitN(v, ",", 2)
+		if len(ss) != 2 {
+			return nil, fmt.Errorf("unexpected %s syntax: %s", rule.name, s)
+		}
+
+		return &MapsymbolParams{
+			File:   ss[0],
+			Symbol: ss[1],
+		}, nil
+	}
+
+	return params, nil
+}
@@ -0,0 +1,194 @@
+package ptproc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/MakeNowJust/heredoc/v2"
+)
+
+func Test_mapsymbolRule_Apply(t *testing.T) {
+	t.Parallel()
+
+	externalFile := func(t *testing.T, filePath string) string {
+		switch filePath {
+		case "external.go":
+			return heredoc.Doc(`
+				package main
+
+				// Greeter greets.
+				type Greeter struct {
+					Name string
+				}
+
+				// Greet returns greeting message.
+				func (g *Greeter) Greet() string {
+					return "Hello, " + g.Name
+				}
+
+				const (
+					// A is a.
+					A = 1
+					B = 2
+				)
+
+				func main() {
+					g := &Greeter{Name: "world"}
+					println(g.Greet())
+				}
+			`)
+		default:
+			t.Fatalf("unexpected external file: %s", filePath)
+			return ""
+		}
+	}
+
+	tests := []struct {
+		name          string
+		startRegExp   *regexp.Regexp
+		endRegExp     *regexp.Regexp
+		externalFile  func(t *testing.T, filePath string) string
+		inputFileName string
+		input         string
+		output        string
+		wantErr       bool
+	}{
+		{
+			name:          "func",
+			externalFile:  externalFile,
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapsymbol:external.go,main
+				mapsymbol.end
+			`),
+			output: heredoc.Doc(`
+				mapsymbol:external.go,main
+				func main() {
+					g := &Greeter{Name: "world"}
+					println(g.Greet())
+				}
+				mapsymbol.end
+			`),
+			wantErr: false,
+		},
+		{
+			name:          "method",
+			externalFile:  externalFile,
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapsymbol:external.go,Greeter.Greet
+				mapsymbol.end
+			`),
+			output: heredoc.Doc(`
+				mapsymbol:external.go,Greeter.Greet
+				func (g *Greeter) Greet() string {
+					return "Hello, " + g.Name
+				}
+				mapsymbol.end
+			`),
+			wantErr: false,
+		},
+		{
+			name:          "type with doc",
+			externalFile:  externalFile,
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapsymbol:file:"external.go",symbol:"Greeter",doc:true
+				mapsymbol.end
+			`),
+			output: heredoc.Doc(`
+				mapsymbol:file:"external.go",symbol:"Greeter",doc:true
+				// Greeter greets.
+				type Greeter struct {
+					Name string
+				}
+				mapsymbol.end
+			`),
+			wantErr: false,
+		},
+		{
+			name:          "grouped const",
+			externalFile:  externalFile,
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapsymbol:file:"external.go",symbol:"A",doc:true
+				mapsymbol.end
+			`),
+			output: heredoc.Doc(`
+				mapsymbol:file:"external.go",symbol:"A",doc:true
+					// A is a.
+					A = 1
+				mapsymbol.end
+			`),
+			wantErr: false,
+		},
+		{
+			name:          "not found",
+			externalFile:  externalFile,
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapsymbol:external.go,Greeter.Hello
+				mapsymbol.end
+			`),
+			wantErr: true,
+		},
+		{
+			name:          "no end directive",
+			externalFile:  externalFile,
+			inputFileName: "test.txt",
+			input: heredoc.Doc(`
+				mapsymbol:external.go,main
+			`),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			rule, err := NewMapsymbolRule(&MapsymbolRuleConfig{
+				StartRegExp: tt.startRegExp,
+				EndRegExp:   tt.endRegExp,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			proc, err := NewProcessor(&ProcessorConfig{
+				OpenFile: func(filePath string) (io.Reader, error) {
+					if tt.inputFileName == filePath {
+						return bytes.NewBufferString(tt.input), nil
+					}
+					if tt.externalFile == nil {
+						return nil, os.ErrNotExist
+					}
+					s := tt.externalFile(t, filePath)
+					return bytes.NewBufferString(s), nil
+				},
+				Rules: []Rule{rule},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output, err := proc.ProcessFile(ctx, tt.inputFileName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			} else {
+				t.Logf("err = %v", err)
+			}
+
+			if !reflect.DeepEqual(output, tt.output) {
+				t.Errorf("got = %v, want %v", output, tt.output)
+			}
+		})
+	}
+}
@@ -1,13 +1,32 @@
 package ptproc
 
+import (
+	"strings"
+)
+
+var _ Node = (*node)(nil)
+var _ Node = (*Block)(nil)
+var _ Node = (*MapFileNode)(nil)
+var _ Node = (*MapFileEndNode)(nil)
+var _ Node = (*MapRangeNode)(nil)
+var _ Node = (*MapSymbolNode)(nil)
+var _ Node = (*RangeNode)(nil)
+var _ Node = (*RangeEndNode)(nil)
+
 type Node interface {
 	isNode()
 
 	Text() string
+	// Line returns 1-origin line number in the source file. returns 0 if the node doesn't come from source.
+	Line() int
+	// Column returns 1-origin column number in the source file. returns 0 if the node doesn't come from source.
+	Column() int
 }
 
 type node struct {
-	text string
+	text   string
+	line   int
+	column int
 }
 
 func (*node) isNode() {}
@@ -16,11 +35,122 @@ func (n *node) Text() string {
 	return n.text
 }
 
+func (n *node) Line() int {
+	return n.line
+}
+
+func (n *node) Column() int {
+	return n.column
+}
+
+// Block is a sequence of lines surrounded by start directive line and end directive line.
+type Block struct {
+	Start Node
+	End   Node
+	Body  []Node
+	// Directive is the text matched by the start directive regexp.
+	Directive string
+	// Kind is the name of the rule which parsed the block. e.g. "mapfile" or the name of a custom directive.
+	Kind        string
+	StartLine   int
+	StartColumn int
+	EndLine     int
+
+	// owner is the rule which parsed the block.
+	// rules of the same kind with different regexps only apply their own blocks.
+	owner Rule
+}
+
+func (*Block) isNode() {}
+
+func (b *Block) Text() string {
+	var buf strings.Builder
+	buf.WriteString(b.Start.Text())
+	for _, n := range b.Body {
+		buf.WriteString(n.Text())
+	}
+	buf.WriteString(b.End.Text())
+	return buf.String()
+}
+
+func (b *Block) Line() int {
+	return b.StartLine
+}
+
+func (b *Block) Column() int {
+	return b.StartColumn
+}
+
+func (b *Block) block() *Block {
+	return b
+}
+
+func (b *Block) wrapError(filePath string, err error) error {
+	return &DirectiveError{
+		FilePath:  filePath,
+		Line:      b.StartLine,
+		Column:    b.StartColumn,
+		Directive: b.Directive,
+		Kind:      b.Kind,
+		Err:       err,
+	}
+}
+
+// replaceContent returns new body. the first and last skip lines of current body are kept around content.
+func (b *Block) replaceContent(skip int, content []Node) []Node {
+	head := min(skip, len(b.Body))
+	rest := b.Body[head:]
+	tail := max(len(rest)-skip, 0)
+
+	newBody := make([]Node, 0, head+len(content)+len(rest)-tail)
+	newBody = append(newBody, b.Body[:head]...)
+	newBody = append(newBody, content...)
+	newBody = append(newBody, rest[tail:]...)
+
+	return newBody
+}
+
+// MapFileNode is a mapfile directive block. End is *MapFileEndNode.
 type MapFileNode struct {
-	Node
+	Block
+	// ImportFile is the file path written in the directive. same as Params.File.
 	ImportFile string
+	Params     *MapfileParams
 }
 
+// MapFileEndNode is the end directive line of a mapfile directive block.
 type MapFileEndNode struct {
 	Node
 }
+
+// MapRangeNode is a maprange directive block.
+type MapRangeNode struct {
+	Block
+	Params *MaprangeParams
+}
+
+// MapSymbolNode is a mapsymbol directive block.
+type MapSymbolNode struct {
+	Block
+	Params *MapsymbolParams
+}
+
+// RangeNode is a range start marker line in the external file.
+// ranges can be nested or overlapped, so the lines of the range are not owned by RangeNode.
+// Body holds the lines between the start and end marker except marker lines of other ranges.
+type RangeNode struct {
+	Block
+	Params *RangeImportParams
+}
+
+// Text returns the text of the start marker line only.
+func (n *RangeNode) Text() string {
+	return n.Start.Text()
+}
+
+// RangeEndNode is a range end marker line in the external file.
+type RangeEndNode struct {
+	Node
+	// Name is the range name specified by the end marker. empty if omitted.
+	Name string
+}
@@ -0,0 +1,115 @@
+package ptproc
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+)
+
+// paramParser parses params of directives written in CUE.
+// building a CUE context is expensive, so one context is shared and results are cached by the directive text.
+// a parser is created for each run of processing a file, so the cache doesn't grow in long running processes like --watch.
+// it is safe for concurrent use.
+type paramParser struct {
+	// mu guards all fields. values of CUE are not safe for concurrent use.
+	mu      sync.Mutex
+	cuectx  *cue.Context
+	schemas map[string]cue.Value
+	cache   map[paramCacheKey]*paramCacheEntry
+}
+
+type paramCacheKey struct {
+	def  string
+	text string
+}
+
+type paramCacheEntry struct {
+	// text is the shorthand form like `external.txt,name`. it is used if value doesn't exist.
+	text  string
+	value cue.Value
+	err   error
+}
+
+func newParamParser() *paramParser {
+	return &paramParser{
+		cuectx:  cuecontext.New(),
+		schemas: make(map[string]cue.Value),
+		cache:   make(map[paramCacheKey]*paramCacheEntry),
+	}
+}
+
+// parseParams parses s as params of the schema definition def.
+// returns the shorthand text if s isn't a CUE struct, otherwise returns the decoded params.
+// params are decoded for each call from the cached value, so callers can modify them.
+func parseParams[T any](ctx context.Context, p *paramParser, def string, s string) (string, *T, error) {
+	var params *T
+	text, err := p.parse(ctx, def, s, func(cv cue.Value) error {
+		params = new(T)
+		return cv.Decode(params)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return text, params, nil
+}
+
+// parse returns the shorthand text, or calls decode with the validated value.
+func (p *paramParser) parse(ctx context.Context, def string, s string, decode func(cv cue.Value) error) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := paramCacheKey{def: def, text: s}
+	entry, ok := p.cache[key]
+	if !ok {
+		entry = p.compile(ctx, def, s)
+		p.cache[key] = entry
+	}
+	if entry.err != nil {
+		return "", entry.err
+	}
+	if !entry.value.Exists() {
+		return entry.text, nil
+	}
+
+	return "", decode(entry.value)
+}
+
+// compile builds the cache entry of s. p.mu must be held.
+func (p *paramParser) compile(ctx context.Context, def string, s string) *paramCacheEntry {
+	entry := &paramCacheEntry{}
+
+	cv := p.cuectx.CompileString(s)
+
+	err := cv.Validate()
+	if err != nil {
+		slog.DebugContext(ctx, "cue validate failed. evaluate to string", "err", err, "value", s)
+		entry.text = s
+		return entry
+	}
+
+	v, err := cv.String()
+	if err == nil {
+		entry.text = v
+		return entry
+	} else {
+		slog.DebugContext(ctx, "failed to convert cue value to string. continue processing", "err", err, "value", s)
+	}
+
+	entry.value, entry.err = validateSchema(p.schema(def), def, cv, nil)
+
+	return entry
+}
+
+// schema returns the compiled definition. p.mu must be held.
+func (p *paramParser) schema(def string) cue.Value {
+	schema, ok := p.schemas[def]
+	if !ok {
+		schema = lookupSchema(p.cuectx, def)
+		p.schemas[def] = schema
+	}
+	return schema
+}
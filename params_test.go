@@ -0,0 +1,117 @@
+package ptproc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"golang.org/x/sync/errgroup"
+)
+
+func Test_parseParams(t *testing.T) {
+	t.Parallel()
+
+	skip := 1
+
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		params  *MaprangeParams
+		wantErr bool
+	}{
+		{
+			name: "shorthand",
+			text: "external.txt,name",
+			want: "external.txt,name",
+		},
+		{
+			name: "quoted shorthand",
+			text: `"external.txt,name"`,
+			want: "external.txt,name",
+		},
+		{
+			name:   "struct",
+			text:   `file:"external.txt",name:"name",skip:1`,
+			params: &MaprangeParams{File: "external.txt", Name: "name", Skip: &skip},
+		},
+		{
+			name:    "unknown field",
+			text:    `file:"external.txt",name:"name",skp:1`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			p := newParamParser()
+
+			// the second call hits the cache.
+			for i := 0; i < 2; i++ {
+				v, params, err := parseParams[MaprangeParams](ctx, p, "MaprangeParams", tt.text)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+				} else {
+					t.Logf("err = %v", err)
+				}
+
+				if v != tt.want {
+					t.Errorf("got = %v, want %v", v, tt.want)
+				}
+				if !reflect.DeepEqual(params, tt.params) {
+					t.Errorf("got = %+v, want %+v", params, tt.params)
+				}
+			}
+		})
+	}
+}
+
+func Test_parseParams_concurrent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	p := newParamParser()
+
+	const text = `file:"concurrent.txt",name:"concurrent",skip:1`
+
+	results := make([]*MaprangeParams, 32)
+
+	var eg errgroup.Group
+	for idx := range results {
+		idx := idx
+		eg.Go(func() error {
+			_, params, err := parseParams[MaprangeParams](ctx, p, "MaprangeParams", text)
+			if err != nil {
+				return err
+			}
+			results[idx] = params
+			return nil
+		})
+	}
+	err := eg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// params are decoded for each call, modifying one of them doesn't affect others.
+	results[0].Name = "modified"
+	*results[0].Skip = 2
+	for _, params := range results[1:] {
+		if params.File != "concurrent.txt" || params.Name != "concurrent" || *params.Skip != 1 {
+			t.Errorf("unexpected params: %+v", params)
+		}
+	}
+
+	_, params, err := parseParams[MaprangeParams](ctx, p, "MaprangeParams", text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Name != "concurrent" || *params.Skip != 1 {
+		t.Errorf("cached params are modified: %+v", params)
+	}
+}
@@ -5,23 +5,53 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
-	"os"
+	"strings"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 )
 
 type Processor interface {
+	// Parse parses content of r into nodes.
+	// if the content doesn't end with newline, Text of the last node doesn't end with newline too.
 	Parse(ctx context.Context, filePath string, r io.Reader) ([]Node, error)
+	// Process processes content of r as the file of filePath.
+	Process(ctx context.Context, filePath string, r io.Reader) (string, error)
 	ProcessFile(ctx context.Context, filePath string) (string, error)
+	// ProcessFileResult processes the file and returns the output with details of directives, dependencies and diagnostics.
+	// the result is returned with the error to report which directive failed.
+	ProcessFileResult(ctx context.Context, filePath string) (*Result, error)
 	WithRules(ctx context.Context, rules []Rule) (Processor, error)
+	// RuleOptions returns the options rules receive when processing filePath.
+	RuleOptions(filePath string) *RuleOptions
 }
 
 type ProcessorConfig struct {
+	// FS is used to read target and external files. OSFS is used if nil.
+	FS fs.FS
+	// Deprecated: use FS instead. it is used only if FS is nil.
 	OpenFile func(filePath string) (io.Reader, error)
 	Rules    []Rule
+	// FileRules select rules by the target file. the first matched one is used instead of Rules.
+	FileRules []*FileRules
+	// RootDir is the project root directory. paths start with "/" or "@root/" are relative to it.
+	RootDir string
+	// IncludePaths are searched in order when the external file is not found relative to the target file.
+	IncludePaths []string
+	// SourceResolver reads files at a revision specified by directives. the git resolver is used if nil.
+	SourceResolver SourceResolver
+	// Sandbox restricts files which directives can read. nil means no restriction.
+	Sandbox *Sandbox
+}
+
+// FileRules are rules for files matched by Match.
+type FileRules struct {
+	Match func(filePath string) bool
+	Rules []Rule
 }
 
 func NewProcessor(cfg *ProcessorConfig) (Processor, error) {
@@ -30,14 +60,27 @@ func NewProcessor(cfg *ProcessorConfig) (Processor, error) {
 	}
 
 	proc := &processor{
-		openFile: cfg.OpenFile,
-		rules:    cfg.Rules,
+		fsys:           cfg.FS,
+		rules:          cfg.Rules,
+		fileRules:      cfg.FileRules,
+		rootDir:        cfg.RootDir,
+		includePaths:   cfg.IncludePaths,
+		sourceResolver: cfg.SourceResolver,
+		sandbox:        cfg.Sandbox,
 	}
 
-	if proc.openFile == nil {
-		proc.openFile = func(filePath string) (io.Reader, error) {
-			return os.OpenFile(filePath, os.O_RDWR, 0o644)
+	if proc.sourceResolver == nil {
+		resolver, err := NewGitResolver(nil)
+		if err != nil {
+			return nil, err
 		}
+		proc.sourceResolver = resolver
+	}
+	if proc.fsys == nil && cfg.OpenFile != nil {
+		proc.fsys = openFileFS(cfg.OpenFile)
+	}
+	if proc.fsys == nil {
+		proc.fsys = OSFS()
 	}
 	if len(proc.rules) == 0 {
 		var rules []Rule
@@ -82,6 +125,30 @@ func NewProcessor(cfg *ProcessorConfig) (Processor, error) {
 			}
 			rules = append(rules, rule)
 		}
+		{
+			var embedRules []Rule
+			{
+				rule, err := NewDedentRule(nil)
+				if err != nil {
+					return nil, err
+				}
+				embedRules = append(embedRules, rule)
+			}
+			{
+				rule, err := NewReindentRule(nil)
+				if err != nil {
+					return nil, err
+				}
+				embedRules = append(embedRules, rule)
+			}
+			rule, err := NewMapsymbolRule(&MapsymbolRuleConfig{
+				EmbedRules: embedRules,
+			})
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, rule)
+		}
 
 		proc.rules = rules
 	}
@@ -92,41 +159,54 @@ func NewProcessor(cfg *ProcessorConfig) (Processor, error) {
 var _ Processor = (*processor)(nil)
 
 type processor struct {
-	openFile func(filePath string) (io.Reader, error)
-	rules    []Rule
+	fsys           fs.FS
+	rules          []Rule
+	fileRules      []*FileRules
+	rootDir        string
+	includePaths   []string
+	sourceResolver SourceResolver
+	sandbox        *Sandbox
+	// params caches params of directives during a run. nil for processors returned by NewProcessor. see run.
+	params *paramParser
 }
 
 func (proc *processor) close() *processor {
 	newProc := &processor{
-		openFile: proc.openFile,
-		rules:    proc.rules,
+		fsys:           proc.fsys,
+		rules:          proc.rules,
+		fileRules:      proc.fileRules,
+		rootDir:        proc.rootDir,
+		includePaths:   proc.includePaths,
+		sourceResolver: proc.sourceResolver,
+		sandbox:        proc.sandbox,
+		params:         proc.params,
 	}
 	return newProc
 }
 
-func (proc *processor) ProcessFile(ctx context.Context, filePath string) (string, error) {
-	slog.DebugContext(ctx, "process file", slog.String("filePath", filePath))
-
-	ns, err := proc.parseFile(ctx, filePath)
-	if err != nil {
-		return "", err
+// run returns the processor for a run of processing a file. params of directives are cached during the run.
+// nested calls in the run like recursive embedding share the cache, the cache is dropped after the run.
+func (proc *processor) run() *processor {
+	if proc.params != nil {
+		return proc
 	}
 
-	ns, err = proc.applyRules(ctx, filePath, ns)
-	if err != nil {
-		return "", err
-	}
+	newProc := proc.close()
+	newProc.params = newParamParser()
+	return newProc
+}
 
-	s, err := proc.formatNodes(ctx, ns)
+func (proc *processor) ProcessFile(ctx context.Context, filePath string) (string, error) {
+	result, err := proc.ProcessFileResult(ctx, filePath)
 	if err != nil {
 		return "", err
 	}
 
-	return s, nil
+	return result.Output, nil
 }
 
-func (proc *processor) parseFile(ctx context.Context, filePath string) (_ []Node, err error) {
-	ctx, span := otel.Tracer("ptproc").Start(ctx, "processor.parseFile")
+func (proc *processor) ProcessFileResult(ctx context.Context, filePath string) (_ *Result, err error) {
+	ctx, span := otel.Tracer("ptproc").Start(ctx, "processor.ProcessFileResult")
 	defer func() {
 		if err != nil {
 			span.RecordError(err)
@@ -134,22 +214,102 @@ func (proc *processor) parseFile(ctx context.Context, filePath string) (_ []Node
 		span.End()
 	}()
 
-	r, err := proc.openFile(filePath)
+	slog.DebugContext(ctx, "process file", slog.String("filePath", filePath))
+
+	proc = proc.run()
+
+	b, err := fs.ReadFile(proc.fsys, filePath)
 	if err != nil {
 		return nil, err
 	}
 
-	rc, ok := r.(io.ReadCloser)
-	if ok {
-		defer func() {
-			err := rc.Close()
-			if err != nil {
-				slog.ErrorContext(ctx, "file close")
-			}
-		}()
+	ns, err := proc.Parse(ctx, filePath, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		FilePath: filePath,
+	}
+	bodies := make(map[int]string)
+	opts := proc.RuleOptions(filePath)
+	for _, n := range ns {
+		d := newDirectiveResult(opts, n)
+		if d == nil {
+			continue
+		}
+		result.Directives = append(result.Directives, d)
+		bodies[d.Line] = bodyText(n.(blockNode).block())
 	}
 
-	return proc.Parse(ctx, filePath, r)
+	r := &recorder{}
+	ns, err = proc.applyRules(contextWithRecorder(ctx, r), filePath, ns)
+	result.Dependencies = r.dependencies()
+	var derr *DirectiveError
+	if errors.As(err, &derr) && derr.FilePath == filePath {
+		if d := result.directive(derr.Line); d != nil {
+			d.Err = derr.Err
+		}
+	}
+	if err != nil {
+		return result, err
+	}
+
+	for _, n := range ns {
+		bn, ok := n.(blockNode)
+		if !ok {
+			continue
+		}
+		d := result.directive(bn.block().StartLine)
+		if d == nil {
+			continue
+		}
+		s := bodyText(bn.block())
+		d.LinesAfter = countLines(s)
+		d.Changed = s != bodies[d.Line]
+		if strings.TrimSpace(s) == "" {
+			result.Diagnostics = append(result.Diagnostics, &Diagnostic{
+				FilePath: filePath,
+				Line:     d.Line,
+				Message:  fmt.Sprintf("%s: embedded content of %s is empty", bn.block().Directive, bn.block().Kind),
+			})
+		}
+	}
+
+	result.Output, err = proc.formatNodes(ctx, ns)
+	if err != nil {
+		return nil, err
+	}
+	result.Changed = result.Output != string(b)
+
+	return result, nil
+}
+
+func (proc *processor) Process(ctx context.Context, filePath string, r io.Reader) (string, error) {
+	slog.DebugContext(ctx, "process", slog.String("filePath", filePath))
+
+	proc = proc.run()
+
+	ns, err := proc.Parse(ctx, filePath, r)
+	if err != nil {
+		return "", err
+	}
+
+	return proc.process(ctx, filePath, ns)
+}
+
+func (proc *processor) process(ctx context.Context, filePath string, ns []Node) (string, error) {
+	ns, err := proc.applyRules(ctx, filePath, ns)
+	if err != nil {
+		return "", err
+	}
+
+	s, err := proc.formatNodes(ctx, ns)
+	if err != nil {
+		return "", err
+	}
+
+	return s, nil
 }
 
 func (proc *processor) Parse(ctx context.Context, filePath string, r io.Reader) (_ []Node, err error) {
@@ -162,22 +322,47 @@ func (proc *processor) Parse(ctx context.Context, filePath string, r io.Reader)
 	}()
 	span.SetAttributes(attribute.String("filePath", filePath))
 
+	proc = proc.run()
+
 	result := make([]Node, 0)
 
 	rdr := bufio.NewReader(r)
-	for {
+	for line := 1; ; line++ {
 		l, err := rdr.ReadString('\n')
 		if errors.Is(err, io.EOF) {
+			// the source doesn't end with newline. keep the last line as is.
+			if l != "" {
+				result = append(result, &node{
+					text:   l,
+					line:   line,
+					column: 1,
+				})
+			}
 			break
 		} else if err != nil {
 			return nil, err
 		}
 
 		result = append(result, &node{
-			text: l,
+			text:   l,
+			line:   line,
+			column: 1,
 		})
 	}
 
+	opts := proc.RuleOptions(filePath)
+	for _, rule := range proc.rulesFor(filePath) {
+		parser, ok := rule.(DirectiveParser)
+		if !ok {
+			continue
+		}
+
+		result, err = parser.ParseDirectives(ctx, opts, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return result, nil
 }
 
@@ -192,12 +377,8 @@ func (proc *processor) applyRules(ctx context.Context, baseFilePath string, ns [
 
 	span.SetAttributes(attribute.String("baseFilePath", baseFilePath), attribute.Int("nodeLength", len(ns)))
 
-	for _, rule := range proc.rules {
-		opts := &RuleOptions{
-			Processor:  proc,
-			OpenFile:   proc.openFile,
-			TargetPath: baseFilePath,
-		}
+	for _, rule := range proc.rulesFor(baseFilePath) {
+		opts := proc.RuleOptions(baseFilePath)
 		ns, err = rule.Apply(ctx, opts, ns)
 		if err != nil {
 			return nil, err
@@ -207,6 +388,29 @@ func (proc *processor) applyRules(ctx context.Context, baseFilePath string, ns [
 	return ns, nil
 }
 
+// rulesFor returns rules for the file.
+func (proc *processor) rulesFor(filePath string) []Rule {
+	for _, fileRules := range proc.fileRules {
+		if fileRules.Match(filePath) {
+			return fileRules.Rules
+		}
+	}
+	return proc.rules
+}
+
+func (proc *processor) RuleOptions(baseFilePath string) *RuleOptions {
+	return &RuleOptions{
+		Processor:      proc,
+		FS:             proc.fsys,
+		TargetPath:     baseFilePath,
+		RootDir:        proc.rootDir,
+		IncludePaths:   proc.includePaths,
+		SourceResolver: proc.sourceResolver,
+		Sandbox:        proc.sandbox,
+		params:         proc.params,
+	}
+}
+
 func (proc *processor) formatNodes(ctx context.Context, ns []Node) (_ string, err error) {
 	ctx, span := otel.Tracer("ptproc").Start(ctx, "processor.formatNodes")
 	defer func() {
@@ -227,5 +431,6 @@ func (proc *processor) formatNodes(ctx context.Context, ns []Node) (_ string, er
 func (proc *processor) WithRules(ctx context.Context, rules []Rule) (Processor, error) {
 	proc = proc.close()
 	proc.rules = rules
+	proc.fileRules = nil
 	return proc, nil
 }
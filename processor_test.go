@@ -1,11 +1,20 @@
 package ptproc
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"testing/fstest"
 
+	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/vvakame/ptproc/internal/testutils"
 )
 
@@ -66,3 +75,728 @@ func Test_process(t *testing.T) {
 		})
 	}
 }
+
+func Test_processor_Parse(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	proc, err := NewProcessor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := heredoc.Doc(`
+		# title
+		<!-- mapfile:file:"external.txt",skip:1 -->
+		old content
+		<!-- mapfile.end -->
+		<!-- maprange:external.txt,name -->
+		<!-- maprange.end -->
+	`)
+
+	ns, err := proc.Parse(ctx, "test.md", bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ns) != 3 {
+		t.Fatalf("unexpected node length: %d", len(ns))
+	}
+
+	if v := ns[0].Line(); v != 1 {
+		t.Errorf("unexpected line: %d", v)
+	}
+
+	mapfileNode, ok := ns[1].(*MapFileNode)
+	if !ok {
+		t.Fatalf("unexpected node type: %T", ns[1])
+	}
+	if v := mapfileNode.StartLine; v != 2 {
+		t.Errorf("unexpected start line: %d", v)
+	}
+	if v := mapfileNode.EndLine; v != 4 {
+		t.Errorf("unexpected end line: %d", v)
+	}
+	if v := mapfileNode.Params.File; v != "external.txt" {
+		t.Errorf("unexpected file: %s", v)
+	}
+	if v := mapfileNode.ImportFile; v != "external.txt" {
+		t.Errorf("unexpected import file: %s", v)
+	}
+	if _, ok := mapfileNode.End.(*MapFileEndNode); !ok {
+		t.Errorf("unexpected end node type: %T", mapfileNode.End)
+	}
+	if v := mapfileNode.Params.Skip; v == nil || *v != 1 {
+		t.Errorf("unexpected skip: %v", v)
+	}
+	if v := len(mapfileNode.Body); v != 1 {
+		t.Errorf("unexpected body length: %d", v)
+	}
+
+	maprangeNode, ok := ns[2].(*MapRangeNode)
+	if !ok {
+		t.Fatalf("unexpected node type: %T", ns[2])
+	}
+	if v := maprangeNode.StartLine; v != 5 {
+		t.Errorf("unexpected start line: %d", v)
+	}
+	if v := maprangeNode.EndLine; v != 6 {
+		t.Errorf("unexpected end line: %d", v)
+	}
+	if v := maprangeNode.Params.Name; v != "name" {
+		t.Errorf("unexpected name: %s", v)
+	}
+	if v := len(maprangeNode.Body); v != 0 {
+		t.Errorf("unexpected body length: %d", v)
+	}
+
+	var buf strings.Builder
+	for _, n := range ns {
+		buf.WriteString(n.Text())
+	}
+	if v := buf.String(); v != input {
+		t.Errorf("got = %v, want %v", v, input)
+	}
+}
+
+func Test_processor_Parse_noNewlineAtEOF(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	proc, err := NewProcessor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := "a\nb"
+
+	ns, err := proc.Parse(ctx, "test.md", bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ns) != 2 {
+		t.Fatalf("unexpected node length: %d", len(ns))
+	}
+	if v := ns[1].Text(); v != "b" {
+		t.Errorf("unexpected text: %s", v)
+	}
+	if v := ns[1].Line(); v != 2 {
+		t.Errorf("unexpected line: %d", v)
+	}
+}
+
+func Test_processor_DirectiveError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		input     string
+		filePath  string
+		line      int
+		column    int
+		directive string
+		kind      string
+	}{
+		{
+			name: "end directive is not found",
+			input: heredoc.Doc(`
+				# title
+
+				<!-- mapfile:external.txt -->
+			`),
+			filePath:  "test.md",
+			line:      3,
+			column:    6,
+			directive: "mapfile:external.txt",
+			kind:      "mapfile",
+		},
+		{
+			name: "unexpected maprange syntax",
+			input: heredoc.Doc(`
+				<!-- maprange:external.txt -->
+				<!-- maprange.end -->
+			`),
+			filePath:  "test.md",
+			line:      1,
+			column:    6,
+			directive: "maprange:external.txt",
+			kind:      "maprange",
+		},
+		{
+			name: "external file is not found",
+			input: heredoc.Doc(`
+				a
+				mapfile:notfound.txt
+				mapfile.end
+			`),
+			filePath:  "test.md",
+			line:      2,
+			column:    1,
+			directive: "mapfile:notfound.txt",
+			kind:      "mapfile",
+		},
+		{
+			name: "range end directive is not found",
+			input: heredoc.Doc(`
+				maprange:external.txt,name
+				maprange.end
+			`),
+			filePath:  "external.txt",
+			line:      2,
+			column:    4,
+			directive: "range:name",
+			kind:      "range",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			proc, err := NewProcessor(&ProcessorConfig{
+				OpenFile: func(filePath string) (io.Reader, error) {
+					switch filePath {
+					case "test.md":
+						return bytes.NewBufferString(tt.input), nil
+					case "external.txt":
+						return bytes.NewBufferString("a\n// range:name\nb\n"), nil
+					default:
+						return nil, os.ErrNotExist
+					}
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = proc.ProcessFile(ctx, "test.md")
+			if err == nil {
+				t.Fatal("error is expected")
+			}
+			t.Logf("err = %v", err)
+
+			// errors in the external file are wrapped by the error of the maprange directive.
+			var derr *DirectiveError
+			for target := err; errors.As(target, &derr); target = derr.Err {
+				if derr.FilePath == tt.filePath {
+					break
+				}
+			}
+			if derr == nil {
+				t.Fatalf("unexpected error type: %T", err)
+			}
+
+			if v := derr.FilePath; v != tt.filePath {
+				t.Errorf("unexpected file path: %s", v)
+			}
+			if v := derr.Line; v != tt.line {
+				t.Errorf("unexpected line: %d", v)
+			}
+			if v := derr.Column; v != tt.column {
+				t.Errorf("unexpected column: %d", v)
+			}
+			if v := derr.Directive; v != tt.directive {
+				t.Errorf("unexpected directive: %s", v)
+			}
+			if v := derr.Kind; v != tt.kind {
+				t.Errorf("unexpected kind: %s", v)
+			}
+		})
+	}
+}
+
+func Test_processor_FS(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	fsys := fstest.MapFS{
+		"docs/test.md": &fstest.MapFile{
+			Data: []byte(heredoc.Doc(`
+				<!-- mapfile:../src/external.txt -->
+				<!-- mapfile.end -->
+				<!-- maprange:../src/external.txt,name -->
+				<!-- maprange.end -->
+			`)),
+			Mode: 0o444,
+		},
+		"src/external.txt": &fstest.MapFile{
+			Data: []byte(heredoc.Doc(`
+				a
+				range:name
+				b
+				range.end
+			`)),
+			Mode: 0o444,
+		},
+	}
+
+	proc, err := NewProcessor(&ProcessorConfig{
+		FS: fsys,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := proc.ProcessFile(ctx, "docs/test.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := heredoc.Doc(`
+		<!-- mapfile:../src/external.txt -->
+		a
+		range:name
+		b
+		range.end
+		<!-- mapfile.end -->
+		<!-- maprange:../src/external.txt,name -->
+		b
+		<!-- maprange.end -->
+	`)
+	if s != expected {
+		t.Errorf("got = %v, want %v", s, expected)
+	}
+}
+
+func Test_processor_RootAndIncludePaths(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"src/a.txt":             &fstest.MapFile{Data: []byte("src/a.txt\n"), Mode: 0o444},
+		"shared/snippets/b.txt": &fstest.MapFile{Data: []byte("shared/snippets/b.txt\n"), Mode: 0o444},
+		"shared/snippets/c.txt": &fstest.MapFile{Data: []byte("shared/snippets/c.txt\n"), Mode: 0o444},
+		"shared/fallback/d.txt": &fstest.MapFile{Data: []byte("shared/fallback/d.txt\n"), Mode: 0o444},
+		"shared/snippets/d.txt": &fstest.MapFile{Data: []byte("shared/snippets/d.txt\n"), Mode: 0o444},
+		"docs/guide/c.txt":      &fstest.MapFile{Data: []byte("docs/guide/c.txt\n"), Mode: 0o444},
+		"project/src/a.txt":     &fstest.MapFile{Data: []byte("project/src/a.txt\n"), Mode: 0o444},
+	}
+
+	tests := []struct {
+		name         string
+		rootDir      string
+		includePaths []string
+		targetPath   string
+		file         string
+		want         string
+		wantErr      bool
+	}{
+		{
+			name:       "slash is relative to root",
+			targetPath: "docs/guide/test.md",
+			file:       "/src/a.txt",
+			want:       "src/a.txt\n",
+		},
+		{
+			name:       "@root is relative to root",
+			targetPath: "docs/guide/test.md",
+			file:       "@root/src/a.txt",
+			want:       "src/a.txt\n",
+		},
+		{
+			name:       "specified root",
+			rootDir:    "project",
+			targetPath: "project/docs/guide/test.md",
+			file:       "@root/src/a.txt",
+			want:       "project/src/a.txt\n",
+		},
+		{
+			name:         "search include paths",
+			includePaths: []string{"shared/snippets"},
+			targetPath:   "docs/guide/test.md",
+			file:         "b.txt",
+			want:         "shared/snippets/b.txt\n",
+		},
+		{
+			name:         "document relative path has priority",
+			includePaths: []string{"shared/snippets"},
+			targetPath:   "docs/guide/test.md",
+			file:         "c.txt",
+			want:         "docs/guide/c.txt\n",
+		},
+		{
+			name:         "include paths are searched in order",
+			includePaths: []string{"shared/fallback", "shared/snippets"},
+			targetPath:   "docs/guide/test.md",
+			file:         "d.txt",
+			want:         "shared/fallback/d.txt\n",
+		},
+		{
+			name:         "not found",
+			includePaths: []string{"shared/snippets"},
+			targetPath:   "docs/guide/test.md",
+			file:         "e.txt",
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			proc, err := NewProcessor(&ProcessorConfig{
+				FS:           fsys,
+				RootDir:      tt.rootDir,
+				IncludePaths: tt.includePaths,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := proc.Process(ctx, tt.targetPath, strings.NewReader("mapfile:"+tt.file+"\nmapfile.end\n"))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Process() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			expected := "mapfile:" + tt.file + "\n" + tt.want + "mapfile.end\n"
+			if s != expected {
+				t.Errorf("got = %v, want %v", s, expected)
+			}
+		})
+	}
+}
+
+func Test_processor_recursiveCycle(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	rootDir := t.TempDir()
+
+	files := map[string]string{
+		"docs/a.md": heredoc.Doc(`
+			mapfile:file:"b.md",recursive:true
+			mapfile.end
+		`),
+		"docs/b.md": heredoc.Doc(`
+			mapfile:file:"@root/docs/a.md",recursive:true
+			mapfile.end
+		`),
+	}
+	for name, content := range files {
+		filePath := filepath.Join(rootDir, name)
+		err := os.MkdirAll(filepath.Dir(filePath), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filePath, []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	proc, err := NewProcessor(&ProcessorConfig{
+		RootDir: rootDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the document is specified by a relative path, but @root/ resolves to an absolute path.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetPath, err := filepath.Rel(wd, filepath.Join(rootDir, "docs/a.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = proc.ProcessFile(ctx, targetPath)
+	if err == nil {
+		t.Fatal("error is expected")
+	}
+	t.Logf("err = %v", err)
+
+	expected := fmt.Sprintf("include cycle detected: %[1]s -> %[2]s -> %[1]s", filepath.Join(rootDir, "docs/a.md"), filepath.Join(rootDir, "docs/b.md"))
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func Test_processor_ProcessFileResult(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	fsys := fstest.MapFS{
+		"docs/test.md": &fstest.MapFile{
+			Data: []byte(heredoc.Doc(`
+				# title
+				<!-- mapfile:../src/external.txt -->
+				<!-- mapfile.end -->
+				<!-- maprange:../src/external.txt,name -->
+				b
+				<!-- maprange.end -->
+				<!-- maprange:file:"../src/external.txt",name:"missing",allowMissing:true -->
+				<!-- maprange.end -->
+			`)),
+			Mode: 0o444,
+		},
+		"docs/error.md": &fstest.MapFile{
+			Data: []byte(heredoc.Doc(`
+				<!-- mapfile:../src/external.txt -->
+				<!-- mapfile.end -->
+				<!-- maprange:../src/external.txt,notfound -->
+				<!-- maprange.end -->
+			`)),
+			Mode: 0o444,
+		},
+		"docs/ranges.md": &fstest.MapFile{
+			Data: []byte(heredoc.Doc(`
+				<!-- maprange:../src/ranges.txt,used -->
+				<!-- maprange.end -->
+			`)),
+			Mode: 0o444,
+		},
+		"src/external.txt": &fstest.MapFile{
+			Data: []byte(heredoc.Doc(`
+				a
+				range:name
+				b
+				range.end
+			`)),
+			Mode: 0o444,
+		},
+		"src/ranges.txt": &fstest.MapFile{
+			Data: []byte(heredoc.Doc(`
+				range:used
+				a
+				range.end
+				range:unused
+				b
+				range.end
+			`)),
+			Mode: 0o444,
+		},
+	}
+
+	proc, err := NewProcessor(&ProcessorConfig{
+		FS: fsys,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := proc.ProcessFileResult(ctx, "docs/test.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*DirectiveResult{
+		{
+			Kind:         "mapfile",
+			Line:         2,
+			File:         "../src/external.txt",
+			ResolvedPath: "src/external.txt",
+			LinesBefore:  0,
+			LinesAfter:   4,
+			Changed:      true,
+		},
+		{
+			Kind:         "maprange",
+			Line:         4,
+			File:         "../src/external.txt",
+			ResolvedPath: "src/external.txt",
+			Name:         "name",
+			LinesBefore:  1,
+			LinesAfter:   1,
+			Changed:      false,
+		},
+		{
+			Kind:         "maprange",
+			Line:         7,
+			File:         "../src/external.txt",
+			ResolvedPath: "src/external.txt",
+			Name:         "missing",
+			LinesBefore:  0,
+			LinesAfter:   1,
+			Changed:      true,
+		},
+	}
+	if !reflect.DeepEqual(result.Directives, expected) {
+		for _, d := range result.Directives {
+			t.Logf("%#v", d)
+		}
+		t.Errorf("unexpected directives")
+	}
+	if v, _ := proc.ProcessFile(ctx, "docs/test.md"); result.Output != v {
+		t.Errorf("got = %v, want %v", result.Output, v)
+	}
+	if !result.Changed {
+		t.Errorf("changed is expected")
+	}
+	if v := len(result.Dependencies); v != 1 {
+		t.Fatalf("unexpected dependencies length: %d", v)
+	}
+	if v := result.Dependencies[0].Path; v != "src/external.txt" {
+		t.Errorf("unexpected dependency path: %s", v)
+	}
+	// sha256 of src/external.txt
+	if v := result.Dependencies[0].Hash; v != "cf2eb95fbcdcb9a879b3f598702ae714630c687aad50b841839545ede2abb7e4" {
+		t.Errorf("unexpected dependency hash: %s", v)
+	}
+	if v := len(result.Diagnostics); v != 1 {
+		t.Fatalf("unexpected diagnostics length: %d", v)
+	}
+	if v := result.Diagnostics[0].String(); v != `docs/test.md:7: maprange:file:"../src/external.txt",name:"missing",allowMissing:true: embedded content of maprange is empty` {
+		t.Errorf("unexpected diagnostic: %s", v)
+	}
+
+	result, err = proc.ProcessFileResult(ctx, "docs/error.md")
+	if err == nil {
+		t.Fatal("error is expected")
+	}
+	if result == nil {
+		t.Fatal("result is expected")
+	}
+	if len(result.Directives) != 2 {
+		t.Fatalf("unexpected directives length: %d", len(result.Directives))
+	}
+	if v := result.Directives[0].Err; v != nil {
+		t.Errorf("unexpected error: %v", v)
+	}
+	if v := result.Directives[1].Err; v == nil {
+		t.Errorf("error is expected")
+	}
+
+	// other ranges in the file may be used by other documents. Lint reports unused ranges.
+	result, err = proc.ProcessFileResult(ctx, "docs/ranges.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := len(result.Diagnostics); v != 0 {
+		t.Errorf("unexpected diagnostics length: %d", v)
+	}
+}
+
+func Test_processor_ProcessFileResult_customDirective(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	fsys := fstest.MapFS{
+		"test.re": &fstest.MapFile{
+			Data: []byte(heredoc.Doc(`
+				#@include(external.txt)
+				#@end
+				#@include(notfound.txt)
+				#@end
+			`)),
+			Mode: 0o444,
+		},
+		"external.txt": &fstest.MapFile{
+			Data: []byte("a\n"),
+			Mode: 0o444,
+		},
+	}
+
+	rule, err := NewMapfileRule(&MapfileRuleConfig{
+		Name:        "include",
+		StartRegExp: regexp.MustCompile(`^#@include\((.+)\)\s*$`),
+		EndRegExp:   regexp.MustCompile(`^#@end\s*$`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc, err := NewProcessor(&ProcessorConfig{
+		FS:    fsys,
+		Rules: []Rule{rule},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := proc.ProcessFileResult(ctx, "test.re")
+	if err == nil {
+		t.Fatal("error is expected")
+	}
+	t.Logf("err = %v", err)
+
+	var derr *DirectiveError
+	if !errors.As(err, &derr) {
+		t.Fatalf("unexpected error type: %T", err)
+	}
+	if v := derr.Kind; v != "include" {
+		t.Errorf("unexpected kind: %s", v)
+	}
+
+	if len(result.Directives) != 2 {
+		t.Fatalf("unexpected directives length: %d", len(result.Directives))
+	}
+	for _, d := range result.Directives {
+		if d.Kind != "include" {
+			t.Errorf("unexpected kind: %s", d.Kind)
+		}
+	}
+}
+
+func Test_processor_run(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	fsys := fstest.MapFS{
+		"test.md": &fstest.MapFile{Data: []byte("a\n"), Mode: 0o444},
+	}
+
+	var parsers []*paramParser
+	rule := ruleFunc(func(ctx context.Context, opts *RuleOptions, ns []Node) ([]Node, error) {
+		parsers = append(parsers, opts.paramParser())
+
+		// nested processors share the parser of the run.
+		subProc, err := opts.Processor.WithRules(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		parsers = append(parsers, subProc.RuleOptions(opts.TargetPath).paramParser())
+
+		return ns, nil
+	})
+
+	proc, err := NewProcessor(&ProcessorConfig{
+		FS:    fsys,
+		Rules: []Rule{rule},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// params are cached only during a run.
+	for i := 0; i < 2; i++ {
+		_, err = proc.ProcessFile(ctx, "test.md")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(parsers) != 4 {
+		t.Fatalf("unexpected parsers length: %d", len(parsers))
+	}
+	if parsers[0] != parsers[1] || parsers[2] != parsers[3] {
+		t.Errorf("parser is not shared in a run")
+	}
+	if parsers[0] == parsers[2] {
+		t.Errorf("parser is shared across runs")
+	}
+	if v := proc.(*processor).params; v != nil {
+		t.Errorf("processor keeps parser: %v", v)
+	}
+}
+
+type ruleFunc func(ctx context.Context, opts *RuleOptions, ns []Node) ([]Node, error)
+
+func (f ruleFunc) Apply(ctx context.Context, opts *RuleOptions, ns []Node) ([]Node, error) {
+	return f(ctx, opts, ns)
+}
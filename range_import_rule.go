@@ -3,23 +3,28 @@ package ptproc
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"regexp"
+	"slices"
+	"strings"
 
-	"cuelang.org/go/cue/cuecontext"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 )
 
 var _ Rule = (*rangeImportRule)(nil)
+var _ DirectiveParser = (*rangeImportRule)(nil)
 
 var DefaultRangeImportStartRegEx = regexp.MustCompile(`range:(?P<Cue>[^\s]+)`)
-var DefaultRangeImportEndRegEx = regexp.MustCompile(`range.end`)
+var DefaultRangeImportEndRegEx = regexp.MustCompile(`range.end(?::(?P<Cue>[^\s]+))?`)
 
 type RangeImportRuleConfig struct {
 	Name        string
 	StartRegExp *regexp.Regexp
 	EndRegExp   *regexp.Regexp
+	// AllowMissing makes the rule return no nodes instead of an error when the range is not found.
+	AllowMissing bool
 }
 
 func NewRangeImportRule(cfg *RangeImportRuleConfig) (Rule, error) {
@@ -28,33 +33,127 @@ func NewRangeImportRule(cfg *RangeImportRuleConfig) (Rule, error) {
 	}
 
 	return &rangeImportRule{
-		targetName:  cfg.Name,
-		startRegExp: cfg.StartRegExp,
-		endRegExp:   cfg.EndRegExp,
+		targetName:   cfg.Name,
+		startRegExp:  cfg.StartRegExp,
+		endRegExp:    cfg.EndRegExp,
+		allowMissing: cfg.AllowMissing,
 	}, nil
 }
 
 type rangeImportRule struct {
-	targetName  string
-	startRegExp *regexp.Regexp
-	endRegExp   *regexp.Regexp
+	targetName   string
+	startRegExp  *regexp.Regexp
+	endRegExp    *regexp.Regexp
+	allowMissing bool
 }
 
-type rangeImportParams struct {
+type RangeImportParams struct {
 	Name string `cue:"name"`
 }
 
-func (rule *rangeImportRule) Apply(ctx context.Context, opts *RuleOptions, ns []Node) (_ []Node, err error) {
-	ctx, span := otel.Tracer("ptproc").Start(ctx, "rangeImportRule.Apply")
-	defer func() {
-		if err != nil {
-			span.RecordError(err)
+func (rule *rangeImportRule) ParseDirectives(ctx context.Context, opts *RuleOptions, ns []Node) (_ []Node, err error) {
+	ns, _, err = rule.parseRanges(ctx, opts, ns)
+	return ns, err
+}
+
+// parseRanges builds range nodes and returns start markers which are not closed.
+// they are left as plain text.
+func (rule *rangeImportRule) parseRanges(ctx context.Context, opts *RuleOptions, ns []Node) ([]Node, []*rangeMarker, error) {
+	markers, err := rule.rangeMarkers(ctx, opts, ns, func(b *Block, err error) error {
+		return b.wrapError(opts.TargetPath, err)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	pairRangeMarkers(markers)
+
+	markerByIndex := make(map[int]*rangeMarker, len(markers))
+	rangeNodes := make(map[*rangeMarker]*RangeNode)
+	var unclosed []*rangeMarker
+	for _, m := range markers {
+		markerByIndex[m.index] = m
+		if m.end {
+			continue
+		}
+		if m.pair == nil {
+			slog.DebugContext(ctx, "range end directive is not found. treated as text", slog.String("name", m.params.Name), slog.Int("line", m.block.StartLine))
+			unclosed = append(unclosed, m)
+			continue
 		}
-		span.End()
-	}()
 
-	span.SetAttributes(attribute.String("targetName", rule.targetName))
+		slog.DebugContext(ctx, "find range directive", slog.String("name", m.params.Name), slog.Int("line", m.block.StartLine))
+
+		rangeNode := &RangeNode{
+			Block:  *m.block,
+			Params: m.params,
+		}
+		rangeNodes[m] = rangeNode
+	}
+
+	newNodes := make([]Node, 0, len(ns))
 
+	// opened ranges. the last one is the innermost.
+	var opened []*RangeNode
+	for idx, n := range ns {
+		m := markerByIndex[idx]
+		switch {
+		case m != nil && m.end:
+			endNode := &RangeEndNode{Node: n}
+			if m.params != nil {
+				endNode.Name = m.params.Name
+			}
+			if m.pair == nil {
+				slog.DebugContext(ctx, "range end directive without start directive. ignored", slog.String("name", endNode.Name), slog.Int("line", n.Line()))
+			} else {
+				rangeNode := rangeNodes[m.pair]
+				rangeNode.End = endNode
+				rangeNode.EndLine = n.Line()
+				opened = slices.DeleteFunc(opened, func(v *RangeNode) bool { return v == rangeNode })
+			}
+			newNodes = append(newNodes, endNode)
+
+		case m != nil && m.pair != nil:
+			rangeNode := rangeNodes[m]
+			opened = append(opened, rangeNode)
+			newNodes = append(newNodes, rangeNode)
+
+		default:
+			for _, rangeNode := range opened {
+				rangeNode.Body = append(rangeNode.Body, n)
+			}
+			newNodes = append(newNodes, n)
+		}
+	}
+
+	return newNodes, unclosed, nil
+}
+
+// rangeMarker is a start or end marker line of ranges.
+type rangeMarker struct {
+	block *Block
+	// index is the index of the line in nodes.
+	index int
+	end   bool
+	// params is nil for end markers without a name.
+	params *RangeImportParams
+	// pair is the matched start or end marker. nil if the marker is not matched.
+	pair *rangeMarker
+	// trailing reports whether the marker is followed by other text on the line.
+	trailing bool
+	// dropped start markers are not matched. see pairRangeMarkers.
+	dropped bool
+}
+
+func (m *rangeMarker) name() string {
+	if m.params == nil {
+		return ""
+	}
+	return m.params.Name
+}
+
+// rangeMarkers returns start and end markers in ns.
+// invalid params are passed to onError, markers are skipped if it returns nil.
+func (rule *rangeImportRule) rangeMarkers(ctx context.Context, opts *RuleOptions, ns []Node, onError func(b *Block, err error) error) ([]*rangeMarker, error) {
 	startRegExp := rule.startRegExp
 	if startRegExp == nil {
 		startRegExp = DefaultRangeImportStartRegEx
@@ -64,69 +163,198 @@ func (rule *rangeImportRule) Apply(ctx context.Context, opts *RuleOptions, ns []
 		endRegExp = DefaultRangeImportEndRegEx
 	}
 
-	slog.DebugContext(ctx, "start range import rule processing")
+	var markers []*rangeMarker
+	for idx, n := range ns {
+		if start, arg, ok := matchDirective(startRegExp, n); ok {
+			start.Kind = "range"
+			params, err := rule.textToParams(ctx, opts, arg)
+			if err != nil {
+				err = onError(start, err)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			rest := n.Text()[start.StartColumn-n.Column()+len(start.Directive):]
+			markers = append(markers, &rangeMarker{block: start, index: idx, params: params, trailing: strings.TrimSpace(rest) != ""})
+			continue
+		}
 
-	newNodes := make([]Node, 0, len(ns))
+		if end, arg, ok := matchDirective(endRegExp, n); ok {
+			end.Kind = "range"
+			m := &rangeMarker{block: end, index: idx, end: true}
+			if arg != "" {
+				params, err := rule.textToParams(ctx, opts, arg)
+				if err != nil {
+					err = onError(end, err)
+					if err != nil {
+						return nil, err
+					}
+					continue
+				}
+				m.params = params
+			}
+			markers = append(markers, m)
+		}
+	}
 
-	var inRangeImportRange bool
-	for _, n := range ns {
-		txt := n.Text()
+	return markers, nil
+}
 
-		if !inRangeImportRange {
-			group := startRegExp.FindStringSubmatch(txt)
+// pairRangeMarkers matches start markers and end markers.
+// a named end marker closes the innermost range of the name, an unnamed one closes the innermost range.
+// code like `f(range:number) {}` matches the start marker regexp too. if an unnamed end marker closes such a line
+// and leaves an outer range unclosed, the start marker is dropped to close more ranges.
+// start markers followed by other text on the line are dropped first.
+func pairRangeMarkers(markers []*rangeMarker) {
+	for {
+		opened := matchRangeMarkers(markers)
+		if len(opened) == 0 {
+			return
+		}
 
-			if len(group) == 2 {
-				params, err := rule.textToParams(ctx, group[1])
-				if err != nil {
-					return nil, err
-				}
+		// start markers which took unnamed end markers the outermost unclosed range could use.
+		var candidates []*rangeMarker
+		var endIndexes []int
+		for _, m := range markers {
+			if m.end || m.pair == nil || m.index < opened[0].index || m.pair.name() != "" {
+				continue
+			}
+			candidates = append(candidates, m)
+			endIndexes = append(endIndexes, m.pair.index)
+		}
 
-				name := params.Name
-				slog.DebugContext(ctx, "find range directive", slog.String("name", name))
+		var drop *rangeMarker
+		var dropEndIndex int
+		minUnclosed := len(opened)
+		for idx, m := range candidates {
+			m.dropped = true
+			unclosed := len(matchRangeMarkers(markers))
+			m.dropped = false
 
-				if name != rule.targetName {
+			switch {
+			case unclosed < minUnclosed:
+			case drop == nil || unclosed > minUnclosed:
+				continue
+			case m.trailing != drop.trailing:
+				if !m.trailing {
 					continue
 				}
-
-				inRangeImportRange = true
+			case endIndexes[idx] < dropEndIndex:
+				continue
 			}
-		} else if endRegExp.MatchString(txt) {
-			inRangeImportRange = false
-		} else {
-			newNodes = append(newNodes, n)
+			drop = m
+			dropEndIndex = endIndexes[idx]
+			minUnclosed = unclosed
+		}
+		if drop == nil {
+			matchRangeMarkers(markers)
+			return
 		}
+		drop.dropped = true
 	}
+}
 
-	if inRangeImportRange {
-		return nil, errors.New("range end directive is not found")
+// matchRangeMarkers matches markers except dropped ones and returns start markers which are not closed.
+func matchRangeMarkers(markers []*rangeMarker) []*rangeMarker {
+	for _, m := range markers {
+		m.pair = nil
 	}
 
-	return newNodes, nil
+	// opened start markers. the last one is the innermost.
+	var opened []*rangeMarker
+	for _, m := range markers {
+		if !m.end {
+			if !m.dropped {
+				opened = append(opened, m)
+			}
+			continue
+		}
+
+		idx := len(opened) - 1
+		if name := m.name(); name != "" {
+			idx = -1
+			for i := len(opened) - 1; i >= 0; i-- {
+				if opened[i].name() == name {
+					idx = i
+					break
+				}
+			}
+		}
+		if idx == -1 {
+			continue
+		}
+		m.pair = opened[idx]
+		opened[idx].pair = m
+		opened = slices.Delete(opened, idx, idx+1)
+	}
+
+	return opened
 }
 
-func (rule *rangeImportRule) textToParams(ctx context.Context, s string) (*rangeImportParams, error) {
-	cuectx := cuecontext.New()
+func (rule *rangeImportRule) Apply(ctx context.Context, opts *RuleOptions, ns []Node) (_ []Node, err error) {
+	ctx, span := otel.Tracer("ptproc").Start(ctx, "rangeImportRule.Apply")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	span.SetAttributes(attribute.String("targetName", rule.targetName))
 
-	cv := cuectx.CompileString(s)
+	slog.DebugContext(ctx, "start range import rule processing")
 
-	err := cv.Validate()
+	ns, unclosed, err := rule.parseRanges(ctx, opts, ns)
 	if err != nil {
-		slog.DebugContext(ctx, "cue validate failed. evaluate to string", "err", err, "value", s)
-		return &rangeImportParams{Name: s}, nil
+		return nil, err
+	}
+
+	newNodes := make([]Node, 0, len(ns))
+
+	var found bool
+	var names []string
+	for _, n := range ns {
+		rangeNode, ok := n.(*RangeNode)
+		if !ok {
+			continue
+		}
+		name := rangeNode.Params.Name
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+		if name != rule.targetName {
+			continue
+		}
+
+		found = true
+		newNodes = append(newNodes, rangeNode.Body...)
 	}
 
-	v, err := cv.String()
-	if err == nil {
-		return &rangeImportParams{Name: v}, nil
-	} else {
-		slog.DebugContext(ctx, "failed to convert cue value to string. continue processing", "err", err, "value", s)
+	if !found && !rule.allowMissing {
+		// unclosed ranges are plain text. they are reported by Lint, but the selected one is an error here.
+		for _, m := range unclosed {
+			if m.params.Name == rule.targetName {
+				return nil, m.block.wrapError(opts.TargetPath, errors.New("range end directive is not found"))
+			}
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("range %q is not found in %s. no ranges are defined", rule.targetName, opts.TargetPath)
+		}
+		return nil, fmt.Errorf("range %q is not found in %s. available ranges: %s", rule.targetName, opts.TargetPath, strings.Join(names, ", "))
 	}
 
-	params := &rangeImportParams{}
-	err = cv.Decode(params)
+	return newNodes, nil
+}
+
+func (rule *rangeImportRule) textToParams(ctx context.Context, opts *RuleOptions, s string) (*RangeImportParams, error) {
+	v, params, err := parseParams[RangeImportParams](ctx, opts.paramParser(), "RangeImportParams", s)
 	if err != nil {
 		return nil, err
 	}
+	if params == nil {
+		return &RangeImportParams{Name: v}, nil
+	}
 
 	return params, nil
 }
@@ -21,6 +21,7 @@ func Test_rangeImportRule_Apply(t *testing.T) {
 		endRegExp     *regexp.Regexp
 		inputFileName string
 		rangeName     string
+		allowMissing  bool
 		input         string
 		output        string
 		wantErr       bool
@@ -84,6 +85,213 @@ func Test_rangeImportRule_Apply(t *testing.T) {
 			`),
 			wantErr: false,
 		},
+		{
+			name:          "nested outer",
+			inputFileName: "test.txt",
+			rangeName:     "outer",
+			input: heredoc.Doc(`
+				range:outer
+				a
+				range:inner
+				b
+				range.end
+				c
+				range.end
+			`),
+			output: heredoc.Doc(`
+				a
+				b
+				c
+			`),
+			wantErr: false,
+		},
+		{
+			name:          "nested inner",
+			inputFileName: "test.txt",
+			rangeName:     "inner",
+			input: heredoc.Doc(`
+				range:outer
+				a
+				range:inner
+				b
+				range.end
+				c
+				range.end
+			`),
+			output: heredoc.Doc(`
+				b
+			`),
+			wantErr: false,
+		},
+		{
+			name:          "overlapping",
+			inputFileName: "test.txt",
+			rangeName:     "name1",
+			input: heredoc.Doc(`
+				range:name1
+				a
+				range:name2
+				b
+				range.end:name1
+				c
+				range.end:name2
+			`),
+			output: heredoc.Doc(`
+				a
+				b
+			`),
+			wantErr: false,
+		},
+		{
+			name:          "overlapping second",
+			inputFileName: "test.txt",
+			rangeName:     "name2",
+			input: heredoc.Doc(`
+				range:name1
+				a
+				range:name2
+				b
+				range.end:"name1"
+				c
+				range.end
+			`),
+			output: heredoc.Doc(`
+				b
+				c
+			`),
+			wantErr: false,
+		},
+		{
+			name:          "no end directive",
+			inputFileName: "test.txt",
+			rangeName:     "name1",
+			input: heredoc.Doc(`
+				range:name1
+				a
+				range:name2
+				b
+				range.end:name2
+			`),
+			wantErr: true,
+		},
+		{
+			name:          "unclosed range is text",
+			inputFileName: "test.txt",
+			rangeName:     "name2",
+			input: heredoc.Doc(`
+				range:name2
+				range:name1
+				b
+				range.end:name2
+			`),
+			output: heredoc.Doc(`
+				range:name1
+				b
+			`),
+			wantErr: false,
+		},
+		{
+			name:          "code like start directive",
+			inputFileName: "test.ts",
+			rangeName:     "sig",
+			input: heredoc.Doc(`
+				// range:sig
+				function f(range:number) {}
+				// range.end
+			`),
+			output: heredoc.Doc(`
+				function f(range:number) {}
+			`),
+			wantErr: false,
+		},
+		{
+			name:          "code like start directive with nested range",
+			inputFileName: "test.ts",
+			rangeName:     "sig",
+			input: heredoc.Doc(`
+				// range:sig
+				function f(range:number) {
+				// range:inner
+				return 1;
+				// range.end
+				}
+				// range.end
+			`),
+			output: heredoc.Doc(`
+				function f(range:number) {
+				return 1;
+				}
+			`),
+			wantErr: false,
+		},
+		{
+			name:          "code like start directive in nested range",
+			inputFileName: "test.ts",
+			rangeName:     "outer",
+			input: heredoc.Doc(`
+				// range:outer
+				// range:inner
+				function f(range:number) {}
+				// range.end
+				// range.end
+			`),
+			output: heredoc.Doc(`
+				function f(range:number) {}
+			`),
+			wantErr: false,
+		},
+		{
+			name:          "unrelated unclosed range",
+			inputFileName: "test.txt",
+			rangeName:     "name1",
+			input: heredoc.Doc(`
+				range:name1
+				a
+				range.end
+				range:name2
+				b
+			`),
+			output: heredoc.Doc(`
+				a
+			`),
+			wantErr: false,
+		},
+		{
+			name:          "missing",
+			inputFileName: "test.txt",
+			rangeName:     "name3",
+			input: heredoc.Doc(`
+				range:name1
+				a
+				range.end
+				range:name2
+				b
+				range.end
+			`),
+			wantErr: true,
+		},
+		{
+			name:          "missing with no ranges",
+			inputFileName: "test.txt",
+			rangeName:     "name1",
+			input: heredoc.Doc(`
+				a
+			`),
+			wantErr: true,
+		},
+		{
+			name:          "allow missing",
+			inputFileName: "test.txt",
+			rangeName:     "name3",
+			allowMissing:  true,
+			input: heredoc.Doc(`
+				range:name1
+				a
+				range.end
+			`),
+			output:  "",
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		tt := tt
@@ -93,9 +301,10 @@ func Test_rangeImportRule_Apply(t *testing.T) {
 			ctx := context.Background()
 
 			rule, err := NewRangeImportRule(&RangeImportRuleConfig{
-				Name:        tt.rangeName,
-				StartRegExp: tt.startRegExp,
-				EndRegExp:   tt.endRegExp,
+				Name:         tt.rangeName,
+				StartRegExp:  tt.startRegExp,
+				EndRegExp:    tt.endRegExp,
+				AllowMissing: tt.allowMissing,
 			})
 			if err != nil {
 				t.Fatal(err)
@@ -84,7 +84,7 @@ func (rule *reindentRule) Apply(ctx context.Context, opts *RuleOptions, ns []Nod
 		txt = strings.ReplaceAll(txt, "\t", strings.Repeat(" ", indentLevel))
 		txt = strings.TrimPrefix(txt, strings.Repeat(" ", count))
 		txt = strings.Repeat(" ", (count/gcdValue)*indentLevel) + txt
-		newNodes = append(newNodes, &node{txt})
+		newNodes = append(newNodes, &node{text: txt, line: n.Line(), column: n.Column()})
 	}
 
 	return newNodes, nil
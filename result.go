@@ -0,0 +1,164 @@
+package ptproc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Result is the result of processing a file.
+type Result struct {
+	FilePath string
+	Output   string
+	// Changed reports whether Output differs from the content of the file.
+	Changed bool
+	// Directives are directives in the file in order of appearance.
+	Directives []*DirectiveResult
+	// Dependencies are external files read while processing, including files read by recursive embedding.
+	Dependencies []*Dependency
+	// Diagnostics are warnings which don't stop processing. e.g. empty embeds.
+	Diagnostics []*Diagnostic
+}
+
+// Dependency is an external file read while processing.
+type Dependency struct {
+	Path string
+	// Rev is the revision of the file. empty if the file is read from the file system.
+	Rev string
+	// Hash is the hex encoded SHA-256 of the content.
+	Hash string
+}
+
+// Diagnostic is a warning about a directive.
+type Diagnostic struct {
+	FilePath string
+	// Line is the 1-origin line number of the start directive.
+	Line    int
+	Message string
+}
+
+func (d *Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d: %s", d.FilePath, d.Line, d.Message)
+}
+
+// DirectiveResult describes a processed directive.
+type DirectiveResult struct {
+	// Kind is the name of the directive. e.g. "mapfile", "maprange", "mapsymbol" or the name of a custom directive.
+	Kind string
+	// Line is the 1-origin line number of the start directive.
+	Line int
+	// File is the file path written in the directive.
+	File string
+	// ResolvedPath is the path of the external file. empty if it can't be resolved.
+	ResolvedPath string
+	// Name is the range name of maprange or the symbol of mapsymbol.
+	Name string
+	// LinesBefore and LinesAfter are the number of lines between directives before and after processing.
+	// LinesAfter and Changed are zero values if processing failed.
+	LinesBefore int
+	LinesAfter  int
+	Changed     bool
+	// Err is the error which occurred while processing the directive.
+	Err error
+}
+
+// newDirectiveResult returns DirectiveResult of n. returns nil if n is not a directive embedding an external file.
+func newDirectiveResult(opts *RuleOptions, n Node) *DirectiveResult {
+	var d *DirectiveResult
+	switch n := n.(type) {
+	case *MapFileNode:
+		d = &DirectiveResult{Kind: "mapfile", File: n.Params.File}
+	case *MapRangeNode:
+		d = &DirectiveResult{Kind: "maprange", File: n.Params.File, Name: n.Params.Name}
+	case *MapSymbolNode:
+		d = &DirectiveResult{Kind: "mapsymbol", File: n.Params.File, Name: n.Params.Symbol}
+	default:
+		return nil
+	}
+
+	b := n.(blockNode).block()
+	if b.Kind != "" {
+		d.Kind = b.Kind
+	}
+	d.Line = b.StartLine
+	d.LinesBefore = countLines(bodyText(b))
+	d.ResolvedPath, _ = opts.ResolvePath(d.File)
+
+	return d
+}
+
+func (result *Result) directive(line int) *DirectiveResult {
+	for _, d := range result.Directives {
+		if d.Line == line {
+			return d
+		}
+	}
+	return nil
+}
+
+func bodyText(b *Block) string {
+	var buf strings.Builder
+	for _, n := range b.Body {
+		buf.WriteString(n.Text())
+	}
+	return buf.String()
+}
+
+func countLines(s string) int {
+	if s == "" {
+		return 0
+	}
+	n := strings.Count(s, "\n")
+	if !strings.HasSuffix(s, "\n") {
+		n++
+	}
+	return n
+}
+
+type recorderKey struct{}
+
+// recorder collects dependencies while processing a file, including files read by recursive embedding.
+type recorder struct {
+	mu   sync.Mutex
+	deps []*Dependency
+}
+
+func recorderFromContext(ctx context.Context) *recorder {
+	r, _ := ctx.Value(recorderKey{}).(*recorder)
+	return r
+}
+
+func contextWithRecorder(ctx context.Context, r *recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+func (r *recorder) addDependency(filePath string, rev string, b []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	filePath = filepath.Clean(filePath)
+	for _, dep := range r.deps {
+		if dep.Path == filePath && dep.Rev == rev {
+			return
+		}
+	}
+
+	sum := sha256.Sum256(b)
+	r.deps = append(r.deps, &Dependency{
+		Path: filePath,
+		Rev:  rev,
+		Hash: hex.EncodeToString(sum[:]),
+	})
+}
+
+func (r *recorder) dependencies() []*Dependency {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.deps)
+}
@@ -2,21 +2,126 @@ package ptproc
 
 import (
 	"context"
-	"io"
+	"fmt"
+	"io/fs"
 	"path/filepath"
+	"strings"
 )
 
 type Rule interface {
 	Apply(ctx context.Context, opts *RuleOptions, nodes []Node) ([]Node, error)
 }
 
+// DirectiveParser is implemented by rules which recognize directive blocks.
+// Processor.Parse uses it to build typed nodes.
+type DirectiveParser interface {
+	ParseDirectives(ctx context.Context, opts *RuleOptions, nodes []Node) ([]Node, error)
+}
+
 type RuleOptions struct {
-	Processor  Processor
-	OpenFile   func(filePath string) (io.Reader, error)
+	Processor Processor
+	// FS is the file system of the processor. rules should read files through it.
+	FS         fs.FS
 	TargetPath string
+	// RootDir is the project root directory. the current directory is used if empty.
+	RootDir string
+	// IncludePaths are searched in order when the external file is not found relative to the target file.
+	IncludePaths []string
+	// SourceResolver reads external files at a revision. nil means revisions are not supported.
+	SourceResolver SourceResolver
+	// Sandbox restricts external files. nil means no restriction.
+	Sandbox *Sandbox
+
+	// params is the parser of the current run. it is nil if the options are not built in a run of the processor.
+	params *paramParser
+}
+
+// paramParser returns the parser of params of directives.
+// a new parser is used if the options are not built in a run of the processor.
+func (opts *RuleOptions) paramParser() *paramParser {
+	if opts.params == nil {
+		opts.params = newParamParser()
+	}
+	return opts.params
 }
 
+// FilePath returns the path of the external file.
+// the path starts with "/" or "@root/" is relative to RootDir.
+// other path is relative to the directory of the target file, then IncludePaths are searched.
 func (opts *RuleOptions) FilePath(externalFilePath string) string {
+	if rest, ok := cutRootPrefix(externalFilePath); ok {
+		rootDir := opts.RootDir
+		if rootDir == "" {
+			rootDir = "."
+		}
+		return filepath.Join(rootDir, rest)
+	}
+
 	dirPath := filepath.Dir(opts.TargetPath)
-	return filepath.Join(dirPath, externalFilePath)
+	filePath := filepath.Join(dirPath, externalFilePath)
+	if len(opts.IncludePaths) == 0 || opts.FS == nil || opts.exists(filePath) {
+		return filePath
+	}
+
+	for _, includePath := range opts.IncludePaths {
+		candidate := filepath.Join(includePath, externalFilePath)
+		if opts.exists(candidate) {
+			return candidate
+		}
+	}
+
+	return filePath
+}
+
+func (opts *RuleOptions) exists(filePath string) bool {
+	_, err := fs.Stat(opts.FS, filePath)
+	return err == nil
+}
+
+func cutRootPrefix(filePath string) (string, bool) {
+	if rest, ok := strings.CutPrefix(filePath, "@root/"); ok {
+		return rest, true
+	}
+	if rest, ok := strings.CutPrefix(filePath, "/"); ok {
+		return rest, true
+	}
+	return filePath, false
+}
+
+// ResolvePath returns the path of the external file like FilePath and checks it by Sandbox.
+func (opts *RuleOptions) ResolvePath(externalFilePath string) (string, error) {
+	filePath := opts.FilePath(externalFilePath)
+
+	if opts.Sandbox != nil {
+		err := opts.Sandbox.Check(filePath)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return filePath, nil
+}
+
+// ReadFile reads the external file resolved by ResolvePath.
+// the file is read from FS if rev is empty, otherwise by SourceResolver.
+// the file is recorded as a dependency of the result of Processor.ProcessFileResult.
+func (opts *RuleOptions) ReadFile(ctx context.Context, filePath string, rev string) ([]byte, error) {
+	var b []byte
+	var err error
+	if rev == "" {
+		b, err = fs.ReadFile(opts.FS, filePath)
+	} else if opts.SourceResolver == nil {
+		return nil, fmt.Errorf("rev %q is specified but source resolver is not configured", rev)
+	} else {
+		b, err = opts.SourceResolver.ReadFile(ctx, filePath, rev)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if r := recorderFromContext(ctx); r != nil {
+		r.addDependency(filePath, rev, b)
+	}
+
+	return b, nil
 }
@@ -0,0 +1,70 @@
+package ptproc
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// ErrPathNotAllowed is returned when a directive points a file outside of the sandbox.
+var ErrPathNotAllowed = errors.New("path is not allowed")
+
+// Sandbox restricts files which directives can read.
+type Sandbox struct {
+	// RootDir is the project root directory. files under it are allowed.
+	RootDir string
+	// AllowedDirs are additional directories allowed to read. e.g. shared examples directory.
+	AllowedDirs []string
+}
+
+// Check returns an error wrapping ErrPathNotAllowed if filePath is outside of RootDir and AllowedDirs.
+// symlinks are resolved if the file exists on the local file system.
+func (sb *Sandbox) Check(filePath string) error {
+	realPath, err := evalPath(filePath)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range append([]string{sb.RootDir}, sb.AllowedDirs...) {
+		if dir == "" {
+			continue
+		}
+
+		realDir, err := evalPath(dir)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(realDir, realPath)
+		if err != nil {
+			continue
+		}
+		if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%s is outside of the root directory %s: %w", filePath, sb.RootDir, ErrPathNotAllowed)
+}
+
+// evalPath returns the absolute path of filePath with symlinks resolved.
+func evalPath(filePath string) (string, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	realPath, err := filepath.EvalSymlinks(absPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		// not on the local file system or not exists. reading it will fail later if needed.
+		return absPath, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return realPath, nil
+}
@@ -0,0 +1,101 @@
+package ptproc
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Sandbox(t *testing.T) {
+	t.Parallel()
+
+	baseDir := t.TempDir()
+
+	writeFile := func(t *testing.T, filePath string, s string) {
+		t.Helper()
+
+		filePath = filepath.Join(baseDir, filePath)
+		err := os.MkdirAll(filepath.Dir(filePath), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filePath, []byte(s), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile(t, "project/src/external.txt", "external.txt content\n")
+	writeFile(t, "examples/example.txt", "example.txt content\n")
+	writeFile(t, "secret.txt", "secret\n")
+	err := os.Symlink(filepath.Join(baseDir, "secret.txt"), filepath.Join(baseDir, "project/src/link.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		wantErr bool
+	}{
+		{
+			name:    "in root",
+			file:    "../src/external.txt",
+			wantErr: false,
+		},
+		{
+			name:    "allowed dir",
+			file:    "../../examples/example.txt",
+			wantErr: false,
+		},
+		{
+			name:    "outside of root",
+			file:    "../../secret.txt",
+			wantErr: true,
+		},
+		{
+			name:    "back to root and outside",
+			file:    "../../project/../secret.txt",
+			wantErr: true,
+		},
+		{
+			name:    "symlink to outside of root",
+			file:    "../src/link.txt",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			targetPath := filepath.Join(baseDir, "project/docs", filepath.Base(t.Name())+".md")
+			writeFile(t, filepath.Join("project/docs", filepath.Base(t.Name())+".md"), "mapfile:"+tt.file+"\nmapfile.end\n")
+
+			proc, err := NewProcessor(&ProcessorConfig{
+				Sandbox: &Sandbox{
+					RootDir:     filepath.Join(baseDir, "project"),
+					AllowedDirs: []string{filepath.Join(baseDir, "examples")},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = proc.ProcessFile(ctx, targetPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			} else {
+				t.Logf("err = %v", err)
+			}
+
+			if tt.wantErr && !errors.Is(err, ErrPathNotAllowed) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// schema of ptproc.yaml, ptproc.cue and params of directives.
+// keep it in sync with Config and *Params structs.
+
+#Config: {
+	root?: string
+	allowedDirs?: [...string]
+	includePaths?: [...string]
+	cacheDir?:  string
+	mapfile?:   #MapfileDirective
+	maprange?:  #MaprangeDirective
+	mapsymbol?: #MapsymbolDirective
+	directives?: [...#CustomDirective]
+	fileTypes?: [...#FileType]
+}
+
+#MapfileDirective: {
+	startRegExp?:          string
+	endRegExp?:            string
+	disableRewriteIndent?: bool
+	indentWidth?:          int & >=0
+	defaultSkip?:          int & >=0
+	recursive?:            bool
+	maxDepth?:             int & >=0
+}
+
+#MaprangeDirective: {
+	startRegExp?:          string
+	endRegExp?:            string
+	disableDedent?:        bool
+	disableRewriteIndent?: bool
+	indentWidth?:          int & >=0
+	defaultSkip?:          int & >=0
+}
+
+#MapsymbolDirective: #MaprangeDirective
+
+#FileType: {
+	patterns: [...string]
+	mapfile?:   #MapfileDirective
+	maprange?:  #MaprangeDirective
+	mapsymbol?: #MapsymbolDirective
+	directives?: [...#CustomDirective]
+}
+
+#CustomDirective: {
+	name:         string
+	// "file", "range", "lines" or "symbol".
+	kind:         string
+	startRegExp?: string
+	endRegExp?:   string
+	defaultSkip?: int & >=0
+	postProcess?: [...#PostProcessStep]
+}
+
+#PostProcessStep: {
+	// "dedent" or "reindent".
+	type:         string
+	indentWidth?: int & >=0
+}
+
+#MapfileParams: {
+	file:         string
+	skip?:        int & >=0
+	recursive?:   bool
+	rev?:         string
+	lines?:       string
+	start?:       int & >=1
+	end?:         int & >=1
+	ellipsis?:    string
+	from?:        string
+	to?:          string
+	excludeFrom?: bool
+	excludeTo?:   bool
+}
+
+#MaprangeParams: {
+	file:          string
+	name:          string
+	skip?:         int & >=0
+	allowMissing?: bool
+	rev?:          string
+}
+
+#MapsymbolParams: {
+	file:   string
+	symbol: string
+	skip?:  int & >=0
+	doc?:   bool
+}
+
+#RangeImportParams: {
+	name: string
+}
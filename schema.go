@@ -0,0 +1,114 @@
+package ptproc
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue"
+	cueerrors "cuelang.org/go/cue/errors"
+	"github.com/goccy/go-yaml/ast"
+)
+
+//go:embed schema.cue
+var schemaSource string
+
+const schemaFileName = "schema.cue"
+
+// lookupSchema returns the definition of the schema compiled in cuectx.
+func lookupSchema(cuectx *cue.Context, def string) cue.Value {
+	return cuectx.CompileString(schemaSource, cue.Filename(schemaFileName)).LookupPath(cue.MakePath(cue.Def(def)))
+}
+
+// validateSchema unifies v with schema, the definition def of the schema. unknown fields are rejected.
+// position returns the position of the value at path for errors. positions of v are used if nil.
+func validateSchema(schema cue.Value, def string, v cue.Value, position func(path []string) string) (cue.Value, error) {
+	v = schema.Unify(v)
+
+	err := v.Validate(cue.Concrete(true))
+	if err != nil {
+		return cue.Value{}, schemaError(def, err, position)
+	}
+
+	return v, nil
+}
+
+// schemaError converts the error of CUE to the error like "ptproc.yaml:3:3: mapfile.disableDedant: field not allowed".
+func schemaError(def string, err error, position func(path []string) string) error {
+	var msgs []string
+	for _, e := range cueerrors.Errors(err) {
+		path := e.Path()
+		if len(path) != 0 && path[0] == "#"+def {
+			path = path[1:]
+		}
+
+		format, args := e.Msg()
+		msg := fmt.Sprintf(format, args...)
+		if len(path) != 0 {
+			msg = fmt.Sprintf("%s: %s", strings.Join(path, "."), msg)
+		}
+
+		if position != nil {
+			if pos := position(path); pos != "" {
+				msg = fmt.Sprintf("%s: %s", pos, msg)
+			}
+			msgs = append(msgs, msg)
+			continue
+		}
+
+		// positions in the schema are not helpful for users.
+		for _, pos := range cueerrors.Positions(e) {
+			if pos.Filename() == "" || pos.Filename() == schemaFileName {
+				continue
+			}
+			msg = fmt.Sprintf("%s: %s", pos, msg)
+			break
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+// yamlPosition returns the function which returns the position of the value at path in the YAML file.
+// the position of the key is used for values in mappings.
+// the position of the nearest existing parent is returned if the value doesn't exist.
+func yamlPosition(filePath string, f *ast.File) func(path []string) string {
+	return func(path []string) string {
+		if len(f.Docs) == 0 || f.Docs[0].Body == nil {
+			return ""
+		}
+
+		n := f.Docs[0].Body
+		tk := n.GetToken()
+	walk:
+		for _, label := range path {
+			switch node := n.(type) {
+			case *ast.MappingNode:
+				for _, mv := range node.Values {
+					if mv.Key.String() == label {
+						n, tk = mv.Value, mv.Key.GetToken()
+						continue walk
+					}
+				}
+			case *ast.MappingValueNode:
+				if node.Key.String() == label {
+					n, tk = node.Value, node.Key.GetToken()
+					continue walk
+				}
+			case *ast.SequenceNode:
+				if idx, err := strconv.Atoi(label); err == nil && 0 <= idx && idx < len(node.Values) {
+					n = node.Values[idx]
+					tk = n.GetToken()
+					continue walk
+				}
+			}
+			break
+		}
+
+		return fmt.Sprintf("%s:%d:%d", filePath, tk.Position.Line, tk.Position.Column)
+	}
+}
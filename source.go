@@ -0,0 +1,199 @@
+package ptproc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var _ SourceResolver = (*gitResolver)(nil)
+
+// SourceResolver reads external files at a revision specified by directives. e.g. `rev:"v1.2.0"`.
+type SourceResolver interface {
+	// ReadFile returns the content of filePath at rev. filePath is the path on the local file system.
+	ReadFile(ctx context.Context, filePath string, rev string) ([]byte, error)
+}
+
+type GitResolverConfig struct {
+	// CacheDir stores resolved contents by the repository and the blob id. contents are not cached if empty.
+	// revs are resolved to blob ids every time, so moving revs like branches are not frozen by the cache.
+	// if a rev can't be resolved, e.g. in shallow clones, the content it pointed to last time is used.
+	CacheDir string
+}
+
+// NewGitResolver returns SourceResolver which reads blobs from the git repository containing the file.
+// it reads the object database of the repository and doesn't need the working tree checkout.
+func NewGitResolver(cfg *GitResolverConfig) (SourceResolver, error) {
+	if cfg == nil {
+		cfg = &GitResolverConfig{}
+	}
+
+	return &gitResolver{
+		cacheDir: cfg.CacheDir,
+	}, nil
+}
+
+type gitResolver struct {
+	cacheDir string
+}
+
+func (r *gitResolver) ReadFile(ctx context.Context, filePath string, rev string) (_ []byte, err error) {
+	ctx, span := otel.Tracer("ptproc").Start(ctx, "gitResolver.ReadFile")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	span.SetAttributes(attribute.String("filePath", filePath), attribute.String("rev", rev))
+
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+	repoDir, err := findRepositoryRoot(filepath.Dir(absPath))
+	if err != nil {
+		return nil, err
+	}
+	relPath, err := filepath.Rel(repoDir, absPath)
+	if err != nil {
+		return nil, err
+	}
+	relPath = filepath.ToSlash(relPath)
+
+	// revs come from directives in documents. don't let them be options of git.
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return nil, fmt.Errorf("invalid rev: %q", rev)
+	}
+
+	var repoCacheDir string
+	if r.cacheDir != "" {
+		// the cache directory may be shared by repositories.
+		sum := sha256.Sum256([]byte(repoDir))
+		repoCacheDir = filepath.Join(r.cacheDir, hex.EncodeToString(sum[:8]))
+	}
+
+	// resolve the blob id every time, moving revs like branches may point to other contents.
+	b, err := runGit(ctx, repoDir, "rev-parse", "--verify", "--end-of-options", rev+":"+relPath)
+	if err != nil {
+		err = fmt.Errorf("failed to resolve %s at %s: %w", relPath, rev, err)
+		if repoCacheDir == "" {
+			return nil, err
+		}
+
+		// the rev may not be available. e.g. shallow clones and offline mirrors.
+		// use the content the rev pointed to when it was resolved last time.
+		b, cacheErr := r.readRevCache(repoCacheDir, rev, relPath)
+		if cacheErr != nil {
+			slog.DebugContext(ctx, "no cached content for the rev", slog.String("rev", rev), slog.String("path", relPath), "err", cacheErr)
+			return nil, err
+		}
+		slog.WarnContext(ctx, "rev can't be resolved. use cached content", slog.String("rev", rev), slog.String("path", relPath), "err", err)
+		return b, nil
+	}
+	blobID := strings.TrimSpace(string(b))
+
+	if repoCacheDir != "" {
+		err = writeCacheFile(r.revCachePath(repoCacheDir, rev, relPath), []byte(blobID))
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := os.ReadFile(filepath.Join(repoCacheDir, blobID))
+		if err == nil {
+			slog.DebugContext(ctx, "use cached content", slog.String("blobID", blobID))
+			return b, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	b, err = runGit(ctx, repoDir, "cat-file", "blob", blobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s at %s: %w", relPath, rev, err)
+	}
+
+	slog.DebugContext(ctx, "read file from git repository", slog.String("repoDir", repoDir), slog.String("path", relPath), slog.String("rev", rev), slog.String("blobID", blobID))
+
+	if repoCacheDir != "" {
+		err = writeCacheFile(filepath.Join(repoCacheDir, blobID), b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// revCachePath returns the path of the file which holds the blob id the rev pointed to.
+func (r *gitResolver) revCachePath(repoCacheDir string, rev string, relPath string) string {
+	sum := sha256.Sum256([]byte(rev + ":" + relPath))
+	return filepath.Join(repoCacheDir, "revs", hex.EncodeToString(sum[:]))
+}
+
+// readRevCache returns the cached content the rev pointed to when it was resolved last time.
+func (r *gitResolver) readRevCache(repoCacheDir string, rev string, relPath string) ([]byte, error) {
+	b, err := os.ReadFile(r.revCachePath(repoCacheDir, rev, relPath))
+	if err != nil {
+		return nil, err
+	}
+	blobID := strings.TrimSpace(string(b))
+	if blobID == "" || strings.ContainsAny(blobID, `/\.`) {
+		return nil, fmt.Errorf("invalid blob id: %q", blobID)
+	}
+
+	return os.ReadFile(filepath.Join(repoCacheDir, blobID))
+}
+
+func writeCacheFile(filePath string, b []byte) error {
+	err := os.MkdirAll(filepath.Dir(filePath), 0o755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, b, 0o644)
+}
+
+// runGit runs git in repoDir and returns its stdout.
+func runGit(ctx context.Context, repoDir string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repoDir}, args...)...)
+	cmd.Stderr = &stderr
+	b, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return b, nil
+}
+
+// findRepositoryRoot returns the nearest ancestor directory which has .git.
+// the directory itself doesn't need to exist because the file may be removed from the working tree.
+func findRepositoryRoot(dir string) (string, error) {
+	for d := dir; ; {
+		_, err := os.Lstat(filepath.Join(d, ".git"))
+		if err == nil {
+			return d, nil
+		} else if !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, fs.ErrInvalid) {
+			return "", err
+		}
+
+		parent := filepath.Dir(d)
+		if parent == d {
+			return "", fmt.Errorf("git repository is not found: %s", dir)
+		}
+		d = parent
+	}
+}
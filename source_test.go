@@ -0,0 +1,225 @@
+package ptproc
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MakeNowJust/heredoc/v2"
+)
+
+func Test_gitResolver(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not found")
+	}
+
+	ctx := context.Background()
+
+	repoDir := t.TempDir()
+	cacheDir := t.TempDir()
+
+	git := func(t *testing.T, args ...string) {
+		t.Helper()
+
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+			"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+		)
+		b, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, b)
+		}
+	}
+	writeFile := func(t *testing.T, filePath string, s string) {
+		t.Helper()
+
+		filePath = filepath.Join(repoDir, filePath)
+		err := os.MkdirAll(filepath.Dir(filePath), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filePath, []byte(s), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git(t, "init", "-q")
+	writeFile(t, "src/external.txt", "a\n// range:name\nold\n// range.end\n")
+	git(t, "add", "-A")
+	git(t, "commit", "-q", "-m", "initial")
+	git(t, "tag", "v1.0.0")
+	writeFile(t, "src/external.txt", "a\n// range:name\nnew\n// range.end\n")
+	writeFile(t, "docs/test.md", heredoc.Doc(`
+		<!-- mapfile:file:"../src/external.txt",rev:"v1.0.0" -->
+		<!-- mapfile.end -->
+		<!-- maprange:file:"../src/external.txt",name:"name",rev:"v1.0.0" -->
+		<!-- maprange.end -->
+		<!-- maprange:../src/external.txt,name -->
+		<!-- maprange.end -->
+	`))
+
+	resolver, err := NewGitResolver(&GitResolverConfig{
+		CacheDir: cacheDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc, err := NewProcessor(&ProcessorConfig{
+		SourceResolver: resolver,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := proc.ProcessFile(ctx, filepath.Join(repoDir, "docs/test.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := heredoc.Doc(`
+		<!-- mapfile:file:"../src/external.txt",rev:"v1.0.0" -->
+		a
+		// range:name
+		old
+		// range.end
+		<!-- mapfile.end -->
+		<!-- maprange:file:"../src/external.txt",name:"name",rev:"v1.0.0" -->
+		old
+		<!-- maprange.end -->
+		<!-- maprange:../src/external.txt,name -->
+		new
+		<!-- maprange.end -->
+	`)
+	if s != expected {
+		t.Errorf("got = %v, want %v", s, expected)
+	}
+
+	// contents are cached by the blob id.
+	var cached []string
+	matches, err := filepath.Glob(filepath.Join(cacheDir, "*", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range matches {
+		if fi, err := os.Stat(s); err == nil && fi.Mode().IsRegular() {
+			cached = append(cached, s)
+		}
+	}
+	if len(cached) != 1 {
+		t.Fatalf("unexpected cache files: %v", cached)
+	}
+	b, err := os.ReadFile(cached[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := string(b); v != "a\n// range:name\nold\n// range.end\n" {
+		t.Errorf("unexpected cache content: %s", v)
+	}
+
+	// moving revs are resolved every time.
+	git(t, "add", "-A")
+	git(t, "commit", "-q", "-m", "update")
+	b, err = resolver.ReadFile(ctx, filepath.Join(repoDir, "src/external.txt"), "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := string(b); !strings.Contains(v, "new") {
+		t.Errorf("unexpected content: %s", v)
+	}
+	b, err = resolver.ReadFile(ctx, filepath.Join(repoDir, "src/external.txt"), "HEAD~1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := string(b); !strings.Contains(v, "old") {
+		t.Errorf("unexpected content: %s", v)
+	}
+
+	_, err = resolver.ReadFile(ctx, filepath.Join(repoDir, "src/external.txt"), "v2.0.0")
+	if err == nil {
+		t.Error("error is expected")
+	}
+
+	// revs which can't be resolved anymore use the cached content. e.g. shallow clones without tags.
+	git(t, "tag", "-d", "v1.0.0")
+	b, err = resolver.ReadFile(ctx, filepath.Join(repoDir, "src/external.txt"), "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := string(b); v != "a\n// range:name\nold\n// range.end\n" {
+		t.Errorf("unexpected content: %s", v)
+	}
+	noCacheResolver, err := NewGitResolver(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = noCacheResolver.ReadFile(ctx, filepath.Join(repoDir, "src/external.txt"), "v1.0.0")
+	if err == nil {
+		t.Error("error is expected")
+	}
+
+	// revs must not be options of git.
+	for _, rev := range []string{"", "--output=" + filepath.Join(repoDir, "out"), "-h"} {
+		_, err = resolver.ReadFile(ctx, filepath.Join(repoDir, "src/external.txt"), rev)
+		if err == nil {
+			t.Errorf("error is expected for rev %q", rev)
+		}
+	}
+}
+
+func Test_gitResolver_sharedCacheDir(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not found")
+	}
+
+	ctx := context.Background()
+
+	cacheDir := t.TempDir()
+
+	resolver, err := NewGitResolver(&GitResolverConfig{
+		CacheDir: cacheDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// repositories have the same path at the same rev with different contents.
+	for _, content := range []string{"repo1\n", "repo2\n"} {
+		repoDir := t.TempDir()
+		for _, args := range [][]string{{"init", "-q"}, {"add", "-A"}, {"commit", "-q", "-m", "initial"}} {
+			if args[0] == "add" {
+				err := os.WriteFile(filepath.Join(repoDir, "external.txt"), []byte(content), 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+			cmd.Env = append(os.Environ(),
+				"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+				"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+				"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+			)
+			b, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, b)
+			}
+		}
+
+		b, err := resolver.ReadFile(ctx, filepath.Join(repoDir, "external.txt"), "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := string(b); v != content {
+			t.Errorf("got = %v, want %v", v, content)
+		}
+	}
+}